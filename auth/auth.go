@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var logger = logging.New("auth")
+
+var (
+	ErrAuthDisabled     = errors.New("accounts are disabled on this server")
+	ErrNameRegistered   = errors.New("username is registered, login required")
+	ErrNameTaken        = errors.New("username is already registered")
+	ErrBadCredentials   = errors.New("wrong username or password")
+	ErrBadToken         = errors.New("session token is invalid or expired")
+	ErrWeakPassword     = errors.New("password must be at least 6 characters")
+	ErrGuestsDisabled   = errors.New("guests are not allowed, please login")
+	ErrGuestPrefix      = errors.New("guest names must start with the guest prefix")
+	ErrReservedForGuest = errors.New("names with the guest prefix cannot be registered")
+)
+
+var (
+	bucketAccounts = []byte("accounts")
+	bucketMeta     = []byte("meta")
+	keySecret      = []byte("token_secret")
+)
+
+// 账号记录，以规范化后的用户名（model.NormalizeUsername）为键，
+// 大小写或全角半角不同的名字属于同一个账号
+type account struct {
+	Username  string `json:"username"` // 注册时的原始写法
+	Hash      []byte `json:"hash"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var (
+	db     *bolt.DB
+	secret []byte
+)
+
+// 打开账号数据库，path 为空时关闭账号功能（所有名字按游客处理）
+func Open(path string) error {
+	if path == "" {
+		return nil
+	}
+	d, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("open account db %s: %w", path, err)
+	}
+
+	// 配置中未指定签名密钥时，使用保存在数据库中的随机密钥
+	key := []byte(model.Conf().Auth.Secret)
+	err = d.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketAccounts); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if len(key) > 0 {
+			return nil
+		}
+		if stored := meta.Get(keySecret); stored != nil {
+			key = append([]byte(nil), stored...)
+			return nil
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		return meta.Put(keySecret, key)
+	})
+	if err != nil {
+		d.Close()
+		return fmt.Errorf("init account db %s: %w", path, err)
+	}
+
+	if err := d.Update(migrateKeys); err != nil {
+		d.Close()
+		return fmt.Errorf("migrate account db %s: %w", path, err)
+	}
+
+	db = d
+	secret = key
+	logger.Info("账号数据库已打开", "path", path)
+	return nil
+}
+
+// 旧版本以原始用户名为键，改为规范化后的键；规范化后重名时较早注册的账号占用新键，
+// 其余的保留原键（无法再登录），留给管理员处理
+func migrateKeys(tx *bolt.Tx) error {
+	b := tx.Bucket(bucketAccounts)
+	type entry struct {
+		key []byte
+		acc account
+	}
+	var stale []entry
+	err := b.ForEach(func(k, v []byte) error {
+		if string(k) == model.NormalizeUsername(string(k)) {
+			return nil
+		}
+		var acc account
+		if err := json.Unmarshal(v, &acc); err != nil {
+			return fmt.Errorf("account %q: %w", k, err)
+		}
+		stale = append(stale, entry{append([]byte(nil), k...), acc})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(stale, func(a, b entry) int { return cmp.Compare(a.acc.CreatedAt, b.acc.CreatedAt) })
+
+	moved := 0
+	for _, e := range stale {
+		key := []byte(model.NormalizeUsername(string(e.key)))
+		if b.Get(key) != nil {
+			logger.Warn("规范化后用户名重复，该账号保留原键且无法登录", "username", e.acc.Username)
+			continue
+		}
+		if err := b.Put(key, append([]byte(nil), b.Get(e.key)...)); err != nil {
+			return err
+		}
+		if err := b.Delete(e.key); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved > 0 {
+		logger.Info("账号键已规范化", "count", moved)
+	}
+	return nil
+}
+
+// 关闭数据库
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// 注册账号，规范化后与已有账号相同的名字视为已注册
+func Register(username, password string) error {
+	if db == nil {
+		return ErrAuthDisabled
+	}
+	if username == "" {
+		return ErrBadCredentials
+	}
+	key := model.NormalizeUsername(username)
+	if prefix := model.Conf().Auth.GuestPrefix; prefix != "" && strings.HasPrefix(key, model.NormalizeUsername(prefix)) {
+		return ErrReservedForGuest
+	}
+	if len(password) < 6 {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(account{
+		Username:  username,
+		Hash:      hash,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAccounts)
+		if b.Get([]byte(key)) != nil {
+			return ErrNameTaken
+		}
+		return b.Put([]byte(key), raw)
+	})
+}
+
+// 校验密码并签发会话令牌
+func Login(username, password string) (string, time.Time, error) {
+	if db == nil {
+		return "", time.Time{}, ErrAuthDisabled
+	}
+	acc, err := getAccount(username)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if acc == nil || bcrypt.CompareHashAndPassword(acc.Hash, []byte(password)) != nil {
+		return "", time.Time{}, ErrBadCredentials
+	}
+	expires := time.Now().Add(time.Duration(model.Conf().Auth.TokenTTLHours) * time.Hour)
+	return signToken(username, expires), expires, nil
+}
+
+// 检查用户能否以该名字进入游戏：已注册的名字需要有效令牌，其余按游客规则处理
+func Authorize(username, token string) error {
+	cfg := model.Conf().Auth
+	if db == nil {
+		return nil
+	}
+	acc, err := getAccount(username)
+	if err != nil {
+		return err
+	}
+	if acc != nil {
+		if token == "" {
+			return ErrNameRegistered
+		}
+		return verifyToken(username, token)
+	}
+	if !cfg.AllowGuests {
+		return ErrGuestsDisabled
+	}
+	if cfg.GuestPrefix != "" && !strings.HasPrefix(username, cfg.GuestPrefix) {
+		return ErrGuestPrefix
+	}
+	return nil
+}
+
+func getAccount(username string) (*account, error) {
+	var acc *account
+	err := db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketAccounts).Get([]byte(model.NormalizeUsername(username)))
+		if raw == nil {
+			return nil
+		}
+		acc = &account{}
+		return json.Unmarshal(raw, acc)
+	})
+	return acc, err
+}
+
+// 令牌格式：base64(username).过期时间.base64(hmac)
+func signToken(username string, expires time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(username)) + "." +
+		strconv.FormatInt(expires.Unix(), 10)
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac(body))
+}
+
+func verifyToken(username, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrBadToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac(parts[0]+"."+parts[1])) {
+		return ErrBadToken
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || model.NormalizeUsername(string(name)) != model.NormalizeUsername(username) {
+		return ErrBadToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrBadToken
+	}
+	return nil
+}
+
+func mac(body string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
@@ -0,0 +1,422 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/model"
+	"github.com/gorilla/websocket"
+)
+
+// 服务端消息类型
+const (
+	TypeNotice      byte = 0
+	TypeMapConfig   byte = 1
+	TypeGameState   byte = 2
+	TypeShot        byte = 3
+	TypeError       byte = 4
+	TypeTankChange  byte = 5
+	TypeHit         byte = 7
+	TypeMatch       byte = 8
+	TypeMatchResult byte = 9
+	TypeLoginResult byte = 10
+	TypeCamera      byte = 11
+	TypeReplay      byte = 12
+	TypeChat        byte = 13
+	TypeSettings    byte = 14
+)
+
+// 客户端消息类型
+const (
+	TypeOperate  byte = 15
+	TypeRegister byte = 16
+	TypeReport   byte = 17
+	TypeRespawn  byte = 18
+	TypeLogin    byte = 19
+	TypeSpectate byte = 20
+	TypeControl  byte = 21
+	TypeSay      byte = 22
+)
+
+// 连接配置
+type Config struct {
+	URL         string // 例如 ws://localhost:8888/ws
+	Username    string
+	Password    string // 非空时先以 type=19 登录，再用返回的令牌注册
+	Register    bool   // 与 Password 一起使用，先注册账号
+	Token       string // 已有的登录令牌
+	ResumeToken string // 断线重连时使用上一次 type=1 中的 resume_token
+	Team        string // 可选，加入的队伍，用于队伍频道
+
+	HandshakeTimeout time.Duration // 默认 10 秒
+	TLSConfig        *tls.Config   // wss:// 使用，为 nil 时按系统根证书校验
+}
+
+// 回调，在读循环的 goroutine 中依次调用，回调中不要长时间阻塞
+type Handlers struct {
+	OnMessage    func(*Message) // 每条消息（包括下面各类型）都会先调用
+	OnConfig     func(*model.MapConfig)
+	OnState      func(*model.GameState)
+	OnShot       func(*model.ShotEvent)
+	OnHit        func(*model.HitPayload)
+	OnTankChange func(*model.TankChangePayload)
+	OnNotice     func(msgType byte, notice string) // type=0 与 type=4
+	OnMatch      func(*model.MatchState)
+	OnResult     func(*model.MatchResultPayload)
+	OnChat       func(*model.ChatMessage)
+	OnSettings   func(*model.SettingsPayload) // 调用前已更新 c.Config 中的对应字段
+	OnClose      func(error)
+}
+
+// 解码后的服务端消息
+type Message struct {
+	Type    byte
+	ID      string
+	Payload interface{} // 对应类型的 model 结构体指针，未知类型为 json.RawMessage
+	Size    int         // 原始消息字节数
+}
+
+// 已完成握手的连接
+type Client struct {
+	Username string
+	Config   *model.MapConfig // 握手时收到的 type=1
+	Token    string           // 登录后获得的令牌
+
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	handlers Handlers
+	keys     model.OperatePayload // 当前按下的方向键，开火时一并发送
+	keysMu   sync.Mutex
+	done     chan struct{}
+	err      error
+}
+
+// 连接服务端并完成 type 0 -> (19 -> 10) -> 16 -> 1 握手，之后开始读循环
+func Dial(ctx context.Context, cfg Config, h Handlers) (*Client, error) {
+	timeout := cfg.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = cfg.TLSConfig
+	conn, _, err := dialer.DialContext(ctx, cfg.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", cfg.URL, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	c := &Client{
+		Username: cfg.Username,
+		Token:    cfg.Token,
+		conn:     conn,
+		handlers: h,
+		done:     make(chan struct{}),
+	}
+	if err := c.handshake(cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Client) handshake(cfg Config) error {
+	if _, err := c.expect(TypeNotice); err != nil {
+		return err
+	}
+
+	if cfg.Password != "" {
+		err := c.send(TypeLogin, model.LoginPayload{
+			Username: cfg.Username,
+			Password: cfg.Password,
+			Register: cfg.Register,
+		})
+		if err != nil {
+			return err
+		}
+		msg, err := c.expect(TypeLoginResult)
+		if err != nil {
+			return err
+		}
+		result := msg.Payload.(*model.LoginResultPayload)
+		if !result.Success {
+			return fmt.Errorf("login failed: %s", result.Notice)
+		}
+		c.Token = result.Token
+	}
+
+	err := c.send(TypeRegister, model.RequestPayload{
+		Username:    cfg.Username,
+		Success:     true,
+		Token:       c.Token,
+		ResumeToken: cfg.ResumeToken,
+		Team:        cfg.Team,
+	})
+	if err != nil {
+		return err
+	}
+	msg, err := c.expect(TypeMapConfig)
+	if err != nil {
+		return err
+	}
+	c.Config = msg.Payload.(*model.MapConfig)
+	return nil
+}
+
+// 读到指定类型为止，期间收到 type=4 视为失败；握手期间的其他广播直接丢弃
+func (c *Client) expect(want byte) (*Message, error) {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("handshake: %w", err)
+		}
+		msg, err := Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("handshake: %w", err)
+		}
+		switch msg.Type {
+		case want:
+			return msg, nil
+		case TypeError:
+			return nil, &ServerError{Notice: msg.Payload.(*model.NoticePayload).Notice}
+		}
+	}
+}
+
+// 服务端以 type=4 拒绝
+type ServerError struct {
+	Notice string
+}
+
+func (e *ServerError) Error() string {
+	return "server: " + e.Notice
+}
+
+// 按类型解码服务端消息
+func Decode(data []byte) (*Message, error) {
+	var raw struct {
+		Type    byte            `json:"type"`
+		ID      string          `json:"id"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	var payload interface{}
+	switch raw.Type {
+	case TypeNotice, TypeError:
+		payload = &model.NoticePayload{}
+	case TypeMapConfig:
+		payload = &model.MapConfig{}
+	case TypeGameState:
+		payload = &model.GameState{}
+	case TypeShot:
+		payload = &model.ShotEvent{}
+	case TypeTankChange:
+		payload = &model.TankChangePayload{}
+	case TypeHit:
+		payload = &model.HitPayload{}
+	case TypeMatch:
+		payload = &model.MatchState{}
+	case TypeMatchResult:
+		payload = &model.MatchResultPayload{}
+	case TypeLoginResult:
+		payload = &model.LoginResultPayload{}
+	case TypeCamera:
+		payload = &model.CameraPayload{}
+	case TypeReplay:
+		payload = &model.ReplayStatusPayload{}
+	case TypeChat:
+		payload = &model.ChatMessage{}
+	case TypeSettings:
+		payload = &model.SettingsPayload{}
+	default:
+		return &Message{Type: raw.Type, ID: raw.ID, Payload: raw.Payload, Size: len(data)}, nil
+	}
+	if err := json.Unmarshal(raw.Payload, payload); err != nil {
+		// 旧版服务端的 type=4 可能不是对象
+		if raw.Type == TypeError {
+			return &Message{Type: raw.Type, ID: raw.ID, Payload: &model.NoticePayload{Notice: string(raw.Payload)}, Size: len(data)}, nil
+		}
+		return nil, fmt.Errorf("decode type %d: %w", raw.Type, err)
+	}
+	return &Message{Type: raw.Type, ID: raw.ID, Payload: payload, Size: len(data)}, nil
+}
+
+func (c *Client) readLoop() {
+	var err error
+	defer func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+		if c.handlers.OnClose != nil {
+			c.handlers.OnClose(err)
+		}
+	}()
+
+	for {
+		var data []byte
+		_, data, err = c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, derr := Decode(data)
+		if derr != nil {
+			continue
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) dispatch(msg *Message) {
+	h := c.handlers
+	if h.OnMessage != nil {
+		h.OnMessage(msg)
+	}
+	switch p := msg.Payload.(type) {
+	case *model.NoticePayload:
+		if h.OnNotice != nil {
+			h.OnNotice(msg.Type, p.Notice)
+		}
+	case *model.MapConfig:
+		c.Config = p
+		if h.OnConfig != nil {
+			h.OnConfig(p)
+		}
+	case *model.GameState:
+		if h.OnState != nil {
+			h.OnState(p)
+		}
+	case *model.ShotEvent:
+		if h.OnShot != nil {
+			h.OnShot(p)
+		}
+	case *model.HitPayload:
+		if h.OnHit != nil {
+			h.OnHit(p)
+		}
+	case *model.TankChangePayload:
+		if h.OnTankChange != nil {
+			h.OnTankChange(p)
+		}
+	case *model.MatchState:
+		if h.OnMatch != nil {
+			h.OnMatch(p)
+		}
+	case *model.MatchResultPayload:
+		if h.OnResult != nil {
+			h.OnResult(p)
+		}
+	case *model.ChatMessage:
+		if h.OnChat != nil {
+			h.OnChat(p)
+		}
+	case *model.SettingsPayload:
+		if c.Config != nil {
+			c.Config.TickInterval = p.TickInterval
+			c.Config.MapRenderMS = p.MapRenderMS
+		}
+		if h.OnSettings != nil {
+			h.OnSettings(p)
+		}
+	}
+}
+
+func (c *Client) send(msgType byte, payload interface{}) error {
+	data, err := json.Marshal(model.WebMessage{Type: msgType, ID: c.Username, Payload: payload})
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// 设置移动方向，全部为 false 时停下
+func (c *Client) Move(up, down, left, right bool) error {
+	op := model.OperatePayload{Up: up, Down: down, Left: left, Right: right}
+	c.keysMu.Lock()
+	c.keys = op
+	c.keysMu.Unlock()
+	return c.send(TypeOperate, op)
+}
+
+// 开火，保持当前移动方向
+func (c *Client) Fire() error {
+	c.keysMu.Lock()
+	op := c.keys
+	c.keysMu.Unlock()
+	op.Action = "fire"
+	return c.send(TypeOperate, op)
+}
+
+// 被击中后请求重生；被转为观战时用于重新加入
+func (c *Client) Respawn() error {
+	return c.send(TypeRespawn, model.RespawnPayload{Username: c.Username, Success: true})
+}
+
+// 报告自己的子弹击中了 victim
+func (c *Client) ReportHit(victim string) error {
+	return c.send(TypeReport, model.HitPayload{Username: c.Username, Victim: victim})
+}
+
+// 向所有玩家发送聊天
+func (c *Client) Say(text string) error {
+	return c.send(TypeSay, model.ChatPayload{Channel: model.ChatAll, Text: text})
+}
+
+// 发给同队玩家，需要在 Config.Team 中声明队伍
+func (c *Client) TeamSay(text string) error {
+	return c.send(TypeSay, model.ChatPayload{Channel: model.ChatTeam, Text: text})
+}
+
+// 私聊，服务端会把消息回显给自己
+func (c *Client) Whisper(to, text string) error {
+	return c.send(TypeSay, model.ChatPayload{Channel: model.ChatWhisper, To: to, Text: text})
+}
+
+// 连接关闭时关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// 读循环结束的原因，连接未关闭时为 nil
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// 发送关闭帧并等待读循环结束
+func (c *Client) Close() error {
+	c.writeMu.Lock()
+	err := c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		c.conn.Close()
+	}
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+		c.conn.Close()
+		<-c.done
+	}
+	return nil
+}
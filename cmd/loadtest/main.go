@@ -0,0 +1,441 @@
+// 压力测试：模拟多名玩家移动、开火、报告命中，
+// 统计广播延迟、消息速率、每客户端流量与服务端帧间隔抖动。
+//
+//	go run ./cmd/loadtest -url ws://localhost:8888/ws -players 50 -duration 1m
+//
+// 广播延迟 = 收到 type=2 的本地时间 - payload 中的 server_time_us，
+// 需要与服务端在同一台机器上运行或已同步时钟。
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/lite_demo/client"
+	"example.com/lite_demo/model"
+)
+
+var (
+	url          = flag.String("url", "ws://localhost:8888/ws", "服务端 websocket 地址")
+	players      = flag.Int("players", 20, "模拟玩家数")
+	duration     = flag.Duration("duration", time.Minute, "测试时长（从第一个玩家连接开始计）")
+	ramp         = flag.Duration("ramp", 5*time.Second, "在这段时间内均匀地建立连接")
+	prefix       = flag.String("prefix", "lt", "用户名前缀，用户名为 <prefix>-<序号>")
+	turnEvery    = flag.Duration("turn", time.Second, "平均换向间隔，实际在 0.5~1.5 倍之间随机")
+	stopChance   = flag.Float64("stop", 0.1, "换向时停下的概率")
+	fireEvery    = flag.Duration("fire", 1500*time.Millisecond, "平均开火间隔（服务端装填中的开火会被忽略）")
+	hitChance    = flag.Float64("hit", 0.3, "开火后报告命中的概率")
+	hitRange     = flag.Float64("hit-range", 200, "只报告此距离（格）内的目标")
+	bulletSpeed  = flag.Float64("bullet-speed", 120, "子弹速度（格/秒），用于推算命中报告的延迟")
+	respawnAfter = flag.Duration("respawn", 2*time.Second, "被击中后多久请求重生")
+	reportEvery  = flag.Duration("report", 5*time.Second, "进度输出间隔，0 表示不输出")
+	timeout      = flag.Duration("handshake-timeout", 10*time.Second, "握手超时")
+	insecure     = flag.Bool("insecure", false, "wss:// 时不校验服务端证书（自签名证书）")
+)
+
+var tlsConfig *tls.Config
+
+// 全局计数
+var (
+	msgsIn    [256]atomic.Int64
+	bytesIn   atomic.Int64
+	msgsOut   atomic.Int64
+	online    atomic.Int64
+	dropped   atomic.Int64 // 测试结束前被服务端断开
+	rejected  atomic.Int64 // 握手时被 type=4 拒绝
+	timedOut  atomic.Int64
+	dialError atomic.Int64
+	hitsSent  atomic.Int64
+	observer  atomic.Int32 // 记录帧间隔的玩家序号 + 1，只取一名玩家避免重复样本
+)
+
+type player struct {
+	idx  int
+	name string
+	c    *client.Client
+
+	handshake time.Duration
+	bytes     int64   // 仅在读循环中写
+	latency   []int64 // 广播延迟（微秒），仅在读循环中写
+	interval  []int64 // 相邻两帧 server_time_us 之差（微秒）
+	lastTick  int64
+
+	alive   atomic.Bool
+	closing atomic.Bool
+	tanks   []*model.Tank
+	tanksMu sync.Mutex
+	rnd     *rand.Rand
+}
+
+func main() {
+	flag.Parse()
+	if *players < 1 {
+		log.Fatal("players must be at least 1")
+	}
+	if *insecure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	ctx, cancel := context.WithDeadline(ctx, start.Add(*duration))
+	defer cancel()
+
+	log.Printf("[loadtest] %s，%d 名玩家，%s 内建立连接，持续 %s", *url, *players, *ramp, *duration)
+
+	all := make([]*player, *players)
+	var wg sync.WaitGroup
+	for i := range all {
+		p := &player{
+			idx:  i,
+			name: fmt.Sprintf("%s-%04d", *prefix, i),
+			rnd:  rand.New(rand.NewSource(time.Now().UnixNano() + int64(i))),
+		}
+		all[i] = p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delay := time.Duration(0)
+			if *players > 1 {
+				delay = *ramp * time.Duration(i) / time.Duration(*players)
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			p.run(ctx)
+		}()
+	}
+
+	if *reportEvery > 0 {
+		go progress(ctx, start)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report(all, elapsed)
+}
+
+func (p *player) run(ctx context.Context) {
+	t0 := time.Now()
+	c, err := client.Dial(ctx, client.Config{
+		URL:              *url,
+		Username:         p.name,
+		HandshakeTimeout: *timeout,
+		TLSConfig:        tlsConfig,
+	}, client.Handlers{
+		OnMessage:    p.onMessage,
+		OnState:      p.onState,
+		OnTankChange: p.onTankChange,
+	})
+	if err != nil {
+		var se *client.ServerError
+		switch {
+		case errors.As(err, &se):
+			rejected.Add(1)
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			timedOut.Add(1)
+		case ctx.Err() != nil:
+			return // 测试已结束
+		default:
+			dialError.Add(1)
+		}
+		log.Printf("⚠️ %s 握手失败: %v", p.name, err)
+		return
+	}
+	p.c = c
+	p.handshake = time.Since(t0)
+	p.alive.Store(true)
+	observer.CompareAndSwap(0, int32(p.idx+1))
+	online.Add(1)
+	defer online.Add(-1)
+
+	turn := time.NewTimer(p.jitter(*turnEvery))
+	fire := time.NewTimer(p.jitter(*fireEvery))
+	defer turn.Stop()
+	defer fire.Stop()
+	p.turn()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.closing.Store(true)
+			c.Close()
+			return
+		case <-c.Done():
+			dropped.Add(1)
+			log.Printf("⚠️ %s 连接断开: %v", p.name, c.Err())
+			return
+		case <-turn.C:
+			p.turn()
+			turn.Reset(p.jitter(*turnEvery))
+		case <-fire.C:
+			p.fire()
+			fire.Reset(p.jitter(*fireEvery))
+		}
+	}
+}
+
+// 在 0.5~1.5 倍之间随机
+func (p *player) jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(p.rnd.Int63n(int64(d)+1))
+}
+
+// 随机换一个八方向之一，偶尔停下
+func (p *player) turn() {
+	if !p.alive.Load() {
+		return
+	}
+	var up, down, left, right bool
+	if p.rnd.Float64() >= *stopChance {
+		switch p.rnd.Intn(3) {
+		case 0:
+			up = true
+		case 1:
+			down = true
+		}
+		switch p.rnd.Intn(3) {
+		case 0:
+			left = true
+		case 1:
+			right = true
+		}
+	}
+	if p.c.Move(up, down, left, right) == nil {
+		msgsOut.Add(1)
+	}
+}
+
+// 开火，按概率在子弹飞到最近的目标后报告命中
+func (p *player) fire() {
+	if !p.alive.Load() {
+		return
+	}
+	if p.c.Fire() != nil {
+		return
+	}
+	msgsOut.Add(1)
+	if p.rnd.Float64() >= *hitChance {
+		return
+	}
+	victim, dist := p.nearest()
+	if victim == "" || dist > *hitRange {
+		return
+	}
+	flight := time.Duration(dist / *bulletSpeed * float64(time.Second))
+	time.AfterFunc(flight, func() {
+		if !p.alive.Load() || p.closing.Load() {
+			return
+		}
+		if p.c.ReportHit(victim) == nil {
+			msgsOut.Add(1)
+			hitsSent.Add(1)
+		}
+	})
+}
+
+// 最近一帧中离自己最近的存活坦克
+func (p *player) nearest() (string, float64) {
+	p.tanksMu.Lock()
+	defer p.tanksMu.Unlock()
+	var self *model.Tank
+	for _, t := range p.tanks {
+		if t.ID == p.name {
+			self = t
+			break
+		}
+	}
+	if self == nil {
+		return "", 0
+	}
+	best, bestDist := "", math.Inf(1)
+	for _, t := range p.tanks {
+		if t.ID == p.name || t.Status != model.StatusTaken {
+			continue
+		}
+		dx := float64(t.LocalX) - float64(self.LocalX)
+		dy := float64(t.LocalY) - float64(self.LocalY)
+		if d := math.Hypot(dx, dy); d < bestDist {
+			best, bestDist = t.ID, d
+		}
+	}
+	return best, bestDist
+}
+
+func (p *player) onMessage(m *client.Message) {
+	msgsIn[m.Type].Add(1)
+	bytesIn.Add(int64(m.Size))
+	p.bytes += int64(m.Size)
+}
+
+func (p *player) onState(s *model.GameState) {
+	now := time.Now().UnixMicro()
+	if s.ServerTime > 0 {
+		p.latency = append(p.latency, now-s.ServerTime)
+		if observer.Load() == int32(p.idx+1) {
+			if p.lastTick > 0 {
+				p.interval = append(p.interval, s.ServerTime-p.lastTick)
+			}
+			p.lastTick = s.ServerTime
+		}
+	}
+	p.tanksMu.Lock()
+	p.tanks = s.Tanks
+	p.tanksMu.Unlock()
+}
+
+// 自己被击中后等待一段时间请求重生
+func (p *player) onTankChange(tc *model.TankChangePayload) {
+	if tc.Username != p.name {
+		return
+	}
+	if tc.TurnTo {
+		p.alive.Store(true)
+		return
+	}
+	p.alive.Store(false)
+	time.AfterFunc(*respawnAfter, func() {
+		if p.closing.Load() {
+			return
+		}
+		if p.c.Respawn() == nil {
+			msgsOut.Add(1)
+		}
+	})
+}
+
+func progress(ctx context.Context, start time.Time) {
+	ticker := time.NewTicker(*reportEvery)
+	defer ticker.Stop()
+	var lastMsgs, lastBytes, lastOut int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var msgs int64
+		for i := range msgsIn {
+			msgs += msgsIn[i].Load()
+		}
+		b, out := bytesIn.Load(), msgsOut.Load()
+		sec := reportEvery.Seconds()
+		log.Printf("[loadtest] %5.0fs 在线 %d/%d  收 %.0f msg/s %s/s  发 %.0f msg/s",
+			time.Since(start).Seconds(), online.Load(), *players,
+			float64(msgs-lastMsgs)/sec, formatBytes(float64(b-lastBytes)/sec), float64(out-lastOut)/sec)
+		lastMsgs, lastBytes, lastOut = msgs, b, out
+	}
+}
+
+func report(all []*player, elapsed time.Duration) {
+	sec := elapsed.Seconds()
+	var handshakes, latency, interval []int64
+	var perClient []int64
+	tick := int64(0)
+	for _, p := range all {
+		if p.c == nil {
+			continue
+		}
+		handshakes = append(handshakes, p.handshake.Microseconds())
+		latency = append(latency, p.latency...)
+		interval = append(interval, p.interval...)
+		perClient = append(perClient, p.bytes)
+		if tick == 0 && p.c.Config != nil {
+			tick = int64(p.c.Config.TickInterval) * 1000
+		}
+	}
+
+	fmt.Printf("\n== 连接（%.1fs）==\n", sec)
+	fmt.Printf("成功 %d / %d  被拒绝 %d  握手超时 %d  其他错误 %d  中途断开 %d\n",
+		len(handshakes), len(all), rejected.Load(), timedOut.Load(), dialError.Load(), dropped.Load())
+	printPercentiles("握手耗时", handshakes)
+
+	fmt.Printf("\n== 广播延迟（type=2，样本 %d）==\n", len(latency))
+	printPercentiles("延迟", latency)
+
+	fmt.Printf("\n== 服务端帧间隔（期望 %s，样本 %d）==\n", time.Duration(tick)*time.Microsecond, len(interval))
+	printPercentiles("间隔", interval)
+	if tick > 0 && len(interval) > 0 {
+		jitter := make([]int64, len(interval))
+		for i, v := range interval {
+			jitter[i] = abs(v - tick)
+		}
+		printPercentiles("抖动", jitter)
+	}
+
+	fmt.Printf("\n== 消息 ==\n")
+	var total int64
+	for t := range msgsIn {
+		n := msgsIn[t].Load()
+		if n == 0 {
+			continue
+		}
+		total += n
+		fmt.Printf("  type=%-3d %10d  %10.1f msg/s\n", t, n, float64(n)/sec)
+	}
+	fmt.Printf("收 %d（%.1f msg/s，%s/s）  发 %d（%.1f msg/s，其中命中报告 %d）\n",
+		total, float64(total)/sec, formatBytes(float64(bytesIn.Load())/sec),
+		msgsOut.Load(), float64(msgsOut.Load())/sec, hitsSent.Load())
+
+	fmt.Printf("\n== 每客户端流量 ==\n")
+	if len(perClient) == 0 {
+		fmt.Println("无")
+		return
+	}
+	sort.Slice(perClient, func(i, j int) bool { return perClient[i] < perClient[j] })
+	var sum int64
+	for _, b := range perClient {
+		sum += b
+	}
+	avg := float64(sum) / float64(len(perClient))
+	fmt.Printf("平均 %s（%s/s）  最小 %s  最大 %s\n",
+		formatBytes(avg), formatBytes(avg/sec),
+		formatBytes(float64(perClient[0])), formatBytes(float64(perClient[len(perClient)-1])))
+}
+
+// 输出 p50/p90/p99/max，单位为微秒的样本按毫秒显示
+func printPercentiles(name string, v []int64) {
+	if len(v) == 0 {
+		fmt.Printf("%s: 无样本\n", name)
+		return
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	at := func(q float64) float64 {
+		return float64(v[int(q*float64(len(v)-1))]) / 1000
+	}
+	fmt.Printf("%s: p50 %.2fms  p90 %.2fms  p99 %.2fms  max %.2fms\n",
+		name, at(0.5), at(0.9), at(0.99), float64(v[len(v)-1])/1000)
+}
+
+func formatBytes(b float64) string {
+	switch {
+	case b >= 1<<20:
+		return fmt.Sprintf("%.2f MB", b/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.1f KB", b/(1<<10))
+	default:
+		return fmt.Sprintf("%.0f B", b)
+	}
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -1,25 +1,170 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/webserver"
 )
 
 type Config struct {
+	ServerPort       int       `json:"server_port"`
+	WebSocketPath    string    `json:"websocket_path"`
+	MapWebSocketPath string    `json:"map_websocket_path"`
+	TLS              TLSConfig `json:"tls"`
+	model.Settings
+}
+
+var AppConfig Config
+
+// 可公开给客户端的配置
+type PublicConfig struct {
 	ServerPort       int    `json:"server_port"`
 	WebSocketPath    string `json:"websocket_path"`
 	MapWebSocketPath string `json:"map_websocket_path"`
+	TLS              bool   `json:"tls"` // 为 true 时使用 wss:// 连接
 }
 
-var AppConfig Config
+// 去掉密钥与本地路径等不应暴露给客户端的配置
+func (c Config) Public() PublicConfig {
+	return PublicConfig{
+		ServerPort:       c.ServerPort,
+		WebSocketPath:    c.WebSocketPath,
+		MapWebSocketPath: c.MapWebSocketPath,
+		TLS:              c.TLS.Enabled(),
+	}
+}
+
+// 配置文件路径，可由 --config 指定
+var configPath = "config.json"
 
 func LoadConfig() error {
-	file, err := os.Open("config.json")
+	cfg, err := readConfig(configPath)
 	if err != nil {
 		return err
 	}
+	AppConfig = cfg
+	return nil
+}
+
+// 读取配置文件并应用环境变量与命令行参数后校验，未出现的字段保留默认值
+func readConfig(path string) (Config, error) {
+	cfg := Config{
+		TLS:      TLSConfig{Hosts: []string{"localhost", "127.0.0.1", "::1"}},
+		Settings: model.DefaultSettings(),
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
-	return decoder.Decode(&AppConfig)
+	// 拼错的字段名直接报错，而不是静默使用默认值
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := applyOverrides(&cfg); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("%s 不合法（已应用环境变量与命令行参数）:\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+// 重新读取配置文件并热加载；端口、路径与 TLS 需要重启
+func reloadConfig() (webserver.ReloadReport, error) {
+	cfg, err := readConfig(configPath)
+	if err != nil {
+		return webserver.ReloadReport{}, err
+	}
+	report, err := webserver.ApplySettings(cfg.Settings, "file")
+	if err != nil {
+		return report, err
+	}
+	if cfg.ServerPort != AppConfig.ServerPort {
+		report.Restart = append(report.Restart, "server_port")
+	}
+	if cfg.WebSocketPath != AppConfig.WebSocketPath {
+		report.Restart = append(report.Restart, "websocket_path")
+	}
+	if cfg.MapWebSocketPath != AppConfig.MapWebSocketPath {
+		report.Restart = append(report.Restart, "map_websocket_path")
+	}
+	if !reflect.DeepEqual(cfg.TLS, AppConfig.TLS) {
+		report.Restart = append(report.Restart, "tls")
+	}
+	return report, nil
+}
+
+// 定期检查配置文件的修改时间与大小，变化时热加载；加载失败时继续使用当前配置
+func watchConfig(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	last, _ := os.Stat(configPath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(configPath)
+		if err != nil {
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+		report, err := reloadConfig()
+		if err != nil {
+			slog.Error("配置文件热加载失败，继续使用当前配置", "path", configPath, "err", err)
+			continue
+		}
+		if len(report.Restart) > 0 {
+			slog.Warn("部分配置需要重启才能生效", "fields", report.Restart)
+		}
+	}
+}
+
+// 校验端口、路径与全部游戏配置
+func (c Config) Validate() error {
+	var errs []error
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		errs = append(errs, fmt.Errorf("server_port must be between 1 and 65535, got %d", c.ServerPort))
+	}
+	for _, p := range [][2]string{
+		{"websocket_path", c.WebSocketPath},
+		{"map_websocket_path", c.MapWebSocketPath},
+	} {
+		if !strings.HasPrefix(p[1], "/") {
+			errs = append(errs, fmt.Errorf("%s must start with /, got %q", p[0], p[1]))
+		}
+	}
+	if c.WebSocketPath == c.MapWebSocketPath {
+		errs = append(errs, fmt.Errorf("websocket_path and map_websocket_path must differ, both are %q", c.WebSocketPath))
+	}
+	errs = append(errs, c.TLS.validate(c.ServerPort)...)
+	if err := c.Settings.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := logging.Validate(c.Log); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"example.com/lite_demo/model"
+)
+
+// 各子系统的日志，级别分别由 log.subsystems 配置
+var (
+	Network = New("network") // 连接、握手、心跳、限速、观战与回放连接
+	Game    = New("game")    // 移动、射击、命中、重生、比赛流程、机器人
+	Map     = New("map")     // 地图生成与载入
+)
+
+var (
+	base     atomic.Pointer[slog.Handler] // 所有子系统共用的输出，切换格式时整体替换
+	levels   = make(map[string]*slog.LevelVar)
+	levelsMu sync.Mutex
+	current  = model.DefaultSettings().Log
+)
+
+func init() {
+	setBase(current.Format)
+}
+
+// 按名字取得子系统日志，未在 log.subsystems 中配置的子系统使用 log.level
+func New(name string) *slog.Logger {
+	levelsMu.Lock()
+	lv, ok := levels[name]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(levelFor(current, name))
+		levels[name] = lv
+	}
+	levelsMu.Unlock()
+	return slog.New(&handler{level: lv}).With("subsystem", name)
+}
+
+// 校验日志配置
+func Validate(cfg model.LogConfig) error {
+	switch cfg.Format {
+	case "", model.LogFormatText, model.LogFormatJSON:
+	default:
+		return fmt.Errorf("log.format must be %q or %q", model.LogFormatText, model.LogFormatJSON)
+	}
+	if _, err := parseLevel(cfg.Level); err != nil {
+		return fmt.Errorf("log.level: %w", err)
+	}
+	for name, l := range cfg.Subsystems {
+		if _, err := parseLevel(l); err != nil {
+			return fmt.Errorf("log.subsystems.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// 应用日志配置，可在运行中重复调用；同时接管标准库 log 的输出
+func Setup(cfg model.LogConfig) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	setBase(cfg.Format)
+
+	levelsMu.Lock()
+	current = cfg
+	for name, lv := range levels {
+		lv.Set(levelFor(cfg, name))
+	}
+	levelsMu.Unlock()
+
+	slog.SetDefault(New("server"))
+	return nil
+}
+
+func setBase(format string) {
+	// 级别由各子系统的 handler 过滤，这里全部放行
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	if format == model.LogFormatJSON {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+	base.Store(&h)
+}
+
+func levelFor(cfg model.LogConfig, name string) slog.Level {
+	if l, ok := cfg.Subsystems[name]; ok {
+		if lv, err := parseLevel(l); err == nil {
+			return lv
+		}
+	}
+	lv, _ := parseLevel(cfg.Level)
+	return lv
+}
+
+// debug/info/warn/error，为空时为 info
+func parseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, err
+	}
+	return l, nil
+}
+
+// 按子系统级别过滤后交给当前的公共输出，输出格式切换后已创建的日志立即生效
+type handler struct {
+	level *slog.LevelVar
+	wrap  []func(slog.Handler) slog.Handler // 依次重放 With/WithGroup
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := *base.Load()
+	for _, w := range h.wrap {
+		out = w(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(o slog.Handler) slog.Handler { return o.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(o slog.Handler) slog.Handler { return o.WithGroup(name) })
+}
+
+func (h *handler) with(w func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wrap, h.wrap)
+	return &handler{level: h.level, wrap: append(wrap, w)}
+}
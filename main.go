@@ -1,20 +1,65 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/auth"
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/metrics"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/replay"
+	"example.com/lite_demo/stats"
+	"example.com/lite_demo/web"
 	"example.com/lite_demo/webserver"
 )
 
 func main() {
 	// 加载配置
+	parseFlags()
 	if err := LoadConfig(); err != nil {
 		log.Fatalf("无法加载配置文件: %v", err)
 	}
+	if *flagPrintConfig {
+		if err := printConfig(AppConfig); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := logging.Setup(AppConfig.Log); err != nil {
+		log.Fatalf("日志配置错误: %v", err)
+	}
+	model.SetConf(AppConfig.Settings)
+	model.TickIntervalMS.Store(int64(AppConfig.Game.TickIntervalMS))
+	model.UP.ReadBufferSize = AppConfig.Network.ReadBufferSize
+	model.UP.WriteBufferSize = AppConfig.Network.WriteBufferSize
+	model.UP.CheckOrigin = webserver.CheckOrigin
+	tlsConfig, err := loadTLS(AppConfig.TLS)
+	if err != nil {
+		log.Fatalf("无法载入 TLS 证书: %v", err)
+	}
+	if err := stats.Open(AppConfig.Stats.DBPath); err != nil {
+		log.Fatalf("无法打开统计数据库: %v", err)
+	}
+	defer stats.Close()
+	if err := auth.Open(AppConfig.Auth.DBPath); err != nil {
+		log.Fatalf("无法打开账号数据库: %v", err)
+	}
+	defer auth.Close()
+	if err := webserver.LoadBans(AppConfig.Admin.BansFile); err != nil {
+		log.Fatalf("无法载入封禁列表: %v", err)
+	}
+	defer replay.Stop()
 	// go func() {
 	// 	for {
 	// 		fmt.Println("========== [调试信息] ==========")
@@ -35,23 +80,104 @@ func main() {
 	// 		time.Sleep(10 * time.Second)
 	// 	}
 	// }()
-	log.SetFlags(log.Lmicroseconds)
-	gamemap.Maprandom()
+	webserver.InitMatch()
 	http.HandleFunc(AppConfig.WebSocketPath, webserver.Handler)
-	http.HandleFunc(AppConfig.MapWebSocketPath, gamemap.WsMapHandler)
+	http.HandleFunc(AppConfig.MapWebSocketPath, webserver.SpectatorHandler)
 
 	// 添加配置API
 	http.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(AppConfig)
+		json.NewEncoder(w).Encode(AppConfig.Public())
 	})
 
-	go webserver.MapRenderloop()
-	go webserver.BroadcastLoop()
+	// 排行榜与玩家统计
+	http.HandleFunc("/leaderboard", stats.LeaderboardHandler)
+	http.HandleFunc("GET /players/{name}/stats", stats.PlayerStatsHandler)
+
+	// Prometheus 指标
+	http.Handle("GET /metrics", metrics.Handler)
+
+	// 管理接口
+	webserver.RegisterAdmin(http.DefaultServeMux)
+
+	// 比赛回放
+	http.HandleFunc("GET /replays", replay.ListHandler)
+	http.HandleFunc("GET /replays/{name}", webserver.ReplayHandler)
+
+	// 内嵌的网页客户端（游戏、观战与调试页面）
+	http.Handle("/", web.Handler)
+
+	// 收到 SIGINT/SIGTERM 时取消 ctx，各循环随之退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var loops sync.WaitGroup
+	for _, loop := range []func(context.Context){
+		webserver.MapRenderloop,
+		webserver.BroadcastLoop,
+		webserver.MatchLoop,
+		webserver.IdleLoop,
+		webserver.BotLoop,
+		func(ctx context.Context) {
+			stats.FlushLoop(ctx, time.Duration(AppConfig.Stats.FlushSeconds)*time.Second)
+		},
+		// 配置热加载
+		func(ctx context.Context) {
+			watchConfig(ctx, time.Duration(AppConfig.ConfigReload.PollSeconds)*time.Second)
+		},
+	} {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			loop(ctx)
+		}()
+	}
+	webserver.ReloadConfigFile = reloadConfig
 
 	addr := fmt.Sprintf("0.0.0.0:%d", AppConfig.ServerPort)
-	log.Printf("WebSocket server started on %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	srv := &http.Server{Addr: addr, TLSConfig: tlsConfig}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// 证书已在 TLSConfig 中
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+	slog.Info("WebSocket server started", "addr", addr, "tls", tlsConfig != nil)
+
+	// 明文端口重定向到 TLS
+	var redirect *http.Server
+	if AppConfig.TLS.RedirectPort != 0 {
+		redirect = redirectServer(AppConfig.TLS.RedirectPort, AppConfig.ServerPort)
+		go func() {
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("redirect ListenAndServe: ", err)
+			}
+		}()
+		slog.Info("HTTP redirect to TLS started", "addr", redirect.Addr)
+	}
+
+	<-ctx.Done()
+	// 再次收到信号时直接退出
+	stop()
+	slog.Info("正在关闭", "timeout_seconds", model.Conf().Shutdown.TimeoutSeconds)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(model.Conf().Shutdown.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	// 先停止监听与普通请求，再通知并断开 websocket 连接（已被接管，Shutdown 不会等待）
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server shutdown", "err", err)
+	}
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
 	}
+	webserver.Shutdown(shutdownCtx)
+	loops.Wait()
+	// 之后由 defer 结束录像、写盘统计并关闭数据库
+	slog.Info("服务已停止")
 }
@@ -1,26 +1,43 @@
 package gamemap
 
 import (
+	"cmp"
+	"fmt"
+	"image/png"
 	"log"
+	"maps"
 	"math"
 	"math/rand"
-	"net/http"
-	"strings"
+	"os"
+	"slices"
 	"time"
 
+	"example.com/lite_demo/logging"
 	"example.com/lite_demo/model"
 	"github.com/fogleman/gg"
 	"github.com/fogleman/poissondisc"
-	"github.com/gorilla/websocket"
 )
 
-// 清空地图
-func clearMap() {
-	for y := 0; y < int(model.MAP_SIZE_Y); y++ {
-		for x := 0; x < int(model.MAP_SIZE_X); x++ {
-			model.Map[y][x] = 0
-		}
+// 地图生成使用的随机数，按 map_gen.seed 播种；生成与载入地图由调用方串行执行
+var (
+	rng    = rand.New(rand.NewSource(time.Now().UnixNano()))
+	seeded int64
+)
+
+// map_gen.seed 变化时重新播种，使之后生成的地图序列可复现
+func reseed(seed int64) {
+	if seed == 0 || seed == seeded {
+		return
 	}
+	rng = rand.New(rand.NewSource(seed))
+	seeded = seed
+	logging.Map.Info("地图随机种子已设置", "seed", seed)
+}
+
+// 清空地图，尺寸按 game.map_size_x/map_size_y 重新分配
+func clearMap() {
+	g := model.Conf().Game
+	model.ResizeMap(g.MapSizeX, g.MapSizeY)
 }
 
 var allowedDirsMap = map[byte][]byte{
@@ -52,7 +69,7 @@ func GenerateRiver(x, y int, steps int) int {
 
 	// 初始化方向偏好（随机初始方向）
 	dirOptions := []byte{1, 2, 3, 4, 6, 7, 8, 9}
-	preferredDir := dirOptions[rand.Intn(len(dirOptions))]
+	preferredDir := dirOptions[rng.Intn(len(dirOptions))]
 	allowedDirsOptions := allowedDirsMap[preferredDir]
 	//log.Printf("%v", allowedDirsOptions)
 	//log.Printf("[河流生成] 初始方向偏好: %d", preferredDir)
@@ -66,7 +83,7 @@ func GenerateRiver(x, y int, steps int) int {
 		}
 		newX, newY := getDirectionDelta(preferredDir)
 		//log.Printf("%v", preferredDir)
-		if newX+x < 0 || newY+y < 0 || newX+x >= int(model.MAP_SIZE_X) || newY+y >= int(model.MAP_SIZE_Y) {
+		if newX+x < 0 || newY+y < 0 || newX+x >= int(model.MapSizeX) || newY+y >= int(model.MapSizeY) {
 			if i < steps/2 {
 				//log.Printf("[河流生成] %d 超出地图范围，跳过", i)
 				for _, p := range bulidedpoints {
@@ -127,7 +144,7 @@ func GenerateTree(x, y int, steps int) int {
 				newX := int(current.X) + dir.X
 				newY := int(current.Y) + dir.Y
 
-				if newX < 0 || newY < 0 || newX >= int(model.MAP_SIZE_X) || newY >= int(model.MAP_SIZE_Y) {
+				if newX < 0 || newY < 0 || newX >= int(model.MapSizeX) || newY >= int(model.MapSizeY) {
 					continue
 				}
 				if model.Map[newY][newX] == 2 {
@@ -168,7 +185,7 @@ func GenerateCircle(centerX, centerY, radius int) int {
 			newX := int(current.X) + dir.X
 			newY := int(current.Y) + dir.Y
 
-			if newX < 0 || newY < 0 || newX >= int(model.MAP_SIZE_X) || newY >= int(model.MAP_SIZE_Y) {
+			if newX < 0 || newY < 0 || newX >= int(model.MapSizeX) || newY >= int(model.MapSizeY) {
 				continue
 			}
 
@@ -193,21 +210,23 @@ func GenerateCircle(centerX, centerY, radius int) int {
 }
 
 func Maprandom() {
+	cfg := model.Conf().MapGen
+	reseed(cfg.Seed)
 	for {
 		clearMap()
 		model.EdgePoints = make(map[[2]int]byte)
 		// 使用泊松盘采样生成随机点
-		x0, y0, x1, y1, r := 0.0, 0.0, float64(model.MAP_SIZE_X), float64(model.MAP_SIZE_Y), 175.0
-		k := 100
+		x0, y0, x1, y1, r := 0.0, 0.0, float64(model.MapSizeX), float64(model.MapSizeY), cfg.PointSpacing
+		k := cfg.PointAttempts
 
 		// 生成点
-		points := poissondisc.Sample(x0, y0, x1, y1, r, k, nil)
+		points := poissondisc.Sample(x0, y0, x1, y1, r, k, rng)
 
 		// 将点四舍五入到整型并填充到 grid
 		for _, p := range points {
 			x, y := int(math.Round(p.X)), int(math.Round(p.Y)) // 关键修改
-			if x >= 0 && y >= 0 && x < int(model.MAP_SIZE_X) && y < int(model.MAP_SIZE_Y) {
-				if rand.Float64() < 0.7 {
+			if x >= 0 && y >= 0 && x < int(model.MapSizeX) && y < int(model.MapSizeY) {
+				if rng.Float64() < cfg.RiverRatio {
 					model.Map[y][x] = 2 // 蓝色点
 					model.EdgePoints[[2]int{int(x), int(y)}] = 2
 				} else {
@@ -217,9 +236,13 @@ func Maprandom() {
 
 			}
 		}
-		for point, value := range model.EdgePoints {
+		// 按坐标顺序生长，保证相同种子生成相同的地图
+		starts := slices.SortedFunc(maps.Keys(model.EdgePoints), func(a, b [2]int) int {
+			return cmp.Or(cmp.Compare(a[1], b[1]), cmp.Compare(a[0], b[0]))
+		})
+		for _, point := range starts {
 			x, y := point[0], point[1]
-			switch value {
+			switch model.EdgePoints[point] {
 			case 3:
 				//log.Printf("[河流生成] 开始生成河流 - 起点: (%d,%d), 计划步数: %d\n", x, y, 20)
 				// fmt.Println("程序正在运行，按回车键继续...")
@@ -228,10 +251,10 @@ func Maprandom() {
 				// fmt.Scanln(&input)
 
 				// fmt.Println("继续执行程序...")
-				if rand.Float64() < 0.5 {
-					GenerateTree(x, y, rand.Intn(10)+50)
+				if rng.Float64() < cfg.TreeRatio {
+					GenerateTree(x, y, randBetween(cfg.TreeStepsMin, cfg.TreeStepsMax))
 				} else {
-					GenerateCircle(x, y, rand.Intn(10)+50)
+					GenerateCircle(x, y, randBetween(cfg.CircleRadiusMin, cfg.CircleRadiusMax))
 				}
 			case 2:
 				//log.Printf("[河流生成] 开始生成河流 - 起点: (%d,%d), 计划步数: %d\n", x, y, 20)
@@ -241,16 +264,16 @@ func Maprandom() {
 				// fmt.Scanln(&input)
 
 				// fmt.Println("继续执行程序...")
-				GenerateRiver(x, y, rand.Intn(200)+100) // 随机生成河流，步数在50到150之间
+				GenerateRiver(x, y, randBetween(cfg.RiverStepsMin, cfg.RiverStepsMax))
 			}
 		}
 		if CheckZeroConnectivity() {
-			dc := gg.NewContext(int(model.MAP_SIZE_X), int(model.MAP_SIZE_Y))
+			dc := gg.NewContext(int(model.MapSizeX), int(model.MapSizeY))
 			dc.SetRGB(1, 1, 1) // 白色背景
 			dc.Clear()
 
-			for y := 0; y < int(model.MAP_SIZE_Y); y++ {
-				for x := 0; x < int(model.MAP_SIZE_X); x++ {
+			for y := 0; y < int(model.MapSizeY); y++ {
+				for x := 0; x < int(model.MapSizeX); x++ {
 					switch model.Map[y][x] {
 					case 2:
 						dc.SetRGB(0, 0, 1) // 蓝色点
@@ -269,17 +292,54 @@ func Maprandom() {
 			}
 			break // 满足条件，退出循环
 		}
-		log.Printf("[地图生成] 生成的地图不满足连通性，重新生成...")
+		logging.Map.Info("生成的地图不满足连通性，重新生成")
+	}
+	model.MapVersion.Add(1)
+	logging.Map.Info("地图生成完成，已保存为 grid_points.png", "version", model.MapVersion.Load())
+}
+
+// 从地图文件载入地图（与 grid_points.png 相同格式：蓝色为河流，绿色为树林，其余为空地）
+func LoadMapFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	b := img.Bounds()
+	g := model.Conf().Game
+	if b.Dx() != int(g.MapSizeX) || b.Dy() != int(g.MapSizeY) {
+		return fmt.Errorf("map %s is %dx%d, want %dx%d (game.map_size_x/map_size_y)", path, b.Dx(), b.Dy(), g.MapSizeX, g.MapSizeY)
+	}
+
+	clearMap()
+	model.EdgePoints = make(map[[2]int]byte)
+	for y := 0; y < int(model.MapSizeY); y++ {
+		for x := 0; x < int(model.MapSizeX); x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			switch {
+			case bl > 0x8000 && r < 0x8000 && g < 0x8000:
+				model.Map[y][x] = 2
+			case g > 0x8000 && r < 0x8000 && bl < 0x8000:
+				model.Map[y][x] = 3
+			}
+		}
 	}
-	log.Printf("[地图生成] 地图生成完成，已保存为 grid_points.png")
+	model.MapVersion.Add(1)
+	logging.Map.Info("已载入地图文件", "path", path, "version", model.MapVersion.Load())
+	return nil
 }
 
 func CheckZeroConnectivity() bool {
 	// 找到第一个 0 作为起点
 	var startX, startY int
 	found := false
-	for y := 0; y < int(model.MAP_SIZE_Y); y++ {
-		for x := 0; x < int(model.MAP_SIZE_X); x++ {
+	for y := 0; y < int(model.MapSizeY); y++ {
+		for x := 0; x < int(model.MapSizeX); x++ {
 			if model.Map[y][x] == 0 {
 				startX, startY = x, y
 				found = true
@@ -298,9 +358,9 @@ func CheckZeroConnectivity() bool {
 	directions := [4]struct{ X, Y int }{
 		{1, 0}, {-1, 0}, {0, 1}, {0, -1},
 	}
-	visited := make([][]bool, model.MAP_SIZE_Y)
+	visited := make([][]bool, model.MapSizeY)
 	for i := range visited {
-		visited[i] = make([]bool, model.MAP_SIZE_X)
+		visited[i] = make([]bool, model.MapSizeX)
 	}
 	queue := []struct{ X, Y int }{{startX, startY}}
 	visited[startY][startX] = true
@@ -312,7 +372,7 @@ func CheckZeroConnectivity() bool {
 
 		for _, dir := range directions {
 			newX, newY := current.X+dir.X, current.Y+dir.Y
-			if newX >= 0 && newY >= 0 && newX < int(model.MAP_SIZE_X) && newY < int(model.MAP_SIZE_Y) {
+			if newX >= 0 && newY >= 0 && newX < int(model.MapSizeX) && newY < int(model.MapSizeY) {
 				if !visited[newY][newX] && model.Map[newY][newX] == 0 {
 					visited[newY][newX] = true
 					queue = append(queue, struct{ X, Y int }{newX, newY})
@@ -324,8 +384,8 @@ func CheckZeroConnectivity() bool {
 
 	// 统计总共有多少个 0
 	totalZeros := 0
-	for y := 0; y < int(model.MAP_SIZE_Y); y++ {
-		for x := 0; x < int(model.MAP_SIZE_X); x++ {
+	for y := 0; y < int(model.MapSizeY); y++ {
+		for x := 0; x < int(model.MapSizeX); x++ {
 			if model.Map[y][x] == 0 {
 				totalZeros++
 			}
@@ -342,7 +402,7 @@ func randomdir(w []float64) int {
 	for i := 0; i < len(w); i++ {
 		total_weight += w[i]
 	}
-	r := rand.Float64() * total_weight
+	r := rng.Float64() * total_weight
 	for i, w := range w {
 		r -= w
 		if r < 0 {
@@ -375,13 +435,20 @@ func getDirectionDelta(dir byte) (int, int) {
 	}
 }
 
-// 序列化地图
-func GetMap() []byte {
-	buf := make([]byte, 0, model.MAP_SIZE_X*model.MAP_SIZE_Y)
-	for y := 0; y < int(model.MAP_SIZE_Y); y++ {
+// [lo, hi] 内的随机整数
+func randBetween(lo, hi int) int {
+	return lo + rng.Intn(hi-lo+1)
+}
+
+// 序列化地图，同时返回尺寸；在 SpawnTanksMu 下复制，调用方不能持有该锁
+func GetMap() ([]byte, uint, uint) {
+	model.SpawnTanksMu.Lock()
+	defer model.SpawnTanksMu.Unlock()
+	buf := make([]byte, 0, model.MapSizeX*model.MapSizeY)
+	for y := 0; y < int(model.MapSizeY); y++ {
 		buf = append(buf, model.Map[y][:]...)
 	}
-	return buf
+	return buf, model.MapSizeX, model.MapSizeY
 }
 
 // 在地图上标记坦克（3x3）
@@ -390,46 +457,9 @@ func MarkTankOnMap(t *model.Tank, val byte) {
 	// 	for dy := -1; dy <= 1; dy++ {
 	// 		x := int(t.LocalX) + dxX
 	// 		y := int(t.LocalY) + dy
-	// 		if x >= 0 && x < int(model.MAP_SIZE_X) && y >= 0 && y < int(model.MAP_SIZE_Y) {
+	// 		if x >= 0 && x < int(model.MapSizeX) && y >= 0 && y < int(model.MapSizeY) {
 	model.Map[t.LocalY][t.LocalX] = val
 	// 		}
 	// 	}
 	// }
 }
-
-func getMapAsString() string {
-	var sb strings.Builder
-	for y := 0; y < int(model.MAP_SIZE_Y); y++ {
-		for x := 0; x < int(model.MAP_SIZE_X); x++ {
-			cell := model.Map[y][x]
-			if cell == 0 {
-				sb.WriteRune('□') // 空地
-			} else {
-				sb.WriteRune('■') // 占用
-			}
-		}
-		sb.WriteByte('\n')
-	}
-	return sb.String()
-}
-
-func WsMapHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := model.UP.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("upgrade error:", err)
-		return
-	}
-	defer conn.Close()
-
-	ticker := time.NewTicker(time.Millisecond * model.TICK_INTERVAL_MS)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		mapStr := getMapAsString()
-		err := conn.WriteMessage(websocket.TextMessage, []byte(mapStr))
-		if err != nil {
-			log.Println("write map error:", err)
-			return
-		}
-	}
-}
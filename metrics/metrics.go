@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"example.com/lite_demo/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tank"
+
+// 帧耗时分桶：0.1ms ~ 约 0.8s
+var tickBuckets = prometheus.ExponentialBuckets(0.0001, 2, 14)
+
+var (
+	tickDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tick_duration_seconds",
+		Help:      "Duration of one iteration of a game loop.",
+		Buckets:   tickBuckets,
+	}, []string{"loop"})
+
+	messagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "WebSocket messages written to clients, by message type.",
+	}, []string{"type"})
+	bytesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_bytes_sent_total",
+		Help:      "Bytes written to clients, by message type.",
+	}, []string{"type"})
+	messagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "WebSocket messages read from clients, by message type.",
+	}, []string{"type"})
+	bytesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_bytes_received_total",
+		Help:      "Bytes read from clients, by message type.",
+	}, []string{"type"})
+
+	handshakeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handshake_failures_total",
+		Help:      "Failed username handshakes: timeout, closed by client, or rejected with type=4.",
+	}, []string{"reason"})
+
+	hits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hits_total",
+		Help:      "Accepted hit reports.",
+	})
+	kills = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kills_total",
+		Help:      "Hits that destroyed a live tank.",
+	})
+	respawns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "respawns_total",
+		Help:      "Successful respawns.",
+	})
+	originRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "origin_rejections_total",
+		Help:      "WebSocket upgrades refused because the Origin header is not allowed.",
+	})
+)
+
+// 统计循环名
+const (
+	LoopMapRender = "map_render"
+	LoopBroadcast = "broadcast"
+)
+
+// 握手失败原因
+const (
+	HandshakeTimeout  = "timeout"
+	HandshakeClosed   = "closed"
+	HandshakeRejected = "rejected"
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "clients",
+		Help:        "Connected clients.",
+		ConstLabels: prometheus.Labels{"kind": "player"},
+	}, func() float64 { return float64(countClients(false)) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "clients",
+		Help:        "Connected clients.",
+		ConstLabels: prometheus.Labels{"kind": "bot"},
+	}, func() float64 { return float64(countClients(true)) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "clients",
+		Help:        "Connected clients.",
+		ConstLabels: prometheus.Labels{"kind": "spectator"},
+	}, func() float64 {
+		model.SpectatorsMu.Lock()
+		defer model.SpectatorsMu.Unlock()
+		return float64(len(model.Spectators))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "suspended_sessions",
+		Help:      "Disconnected players whose tank is kept for reconnection.",
+	}, func() float64 {
+		model.ClientsMu.Lock()
+		defer model.ClientsMu.Unlock()
+		n := 0
+		for _, c := range model.Clients {
+			if c.Suspended {
+				n++
+			}
+		}
+		return float64(n)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_tanks",
+		Help:      "Tanks currently taken by a player or bot.",
+	}, func() float64 {
+		model.SpawnTanksMu.Lock()
+		defer model.SpawnTanksMu.Unlock()
+		n := 0
+		for _, t := range model.SpawnTanks {
+			if t.Status == model.StatusTaken {
+				n++
+			}
+		}
+		return float64(n)
+	})
+}
+
+// 在线玩家或机器人数，不含挂起的会话
+func countClients(bot bool) int {
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+	n := 0
+	for _, c := range model.Clients {
+		if c.Bot == bot && !c.Suspended {
+			n++
+		}
+	}
+	return n
+}
+
+// GET /metrics
+var Handler = promhttp.Handler()
+
+// 记录一次循环耗时，用法：defer metrics.ObserveTick(metrics.LoopBroadcast, time.Now())
+func ObserveTick(loop string, start time.Time) {
+	tickDuration.WithLabelValues(loop).Observe(time.Since(start).Seconds())
+}
+
+// 记录写给客户端的一条消息，类型从 RePackWebMessageJson 输出的 {"type":N, 前缀中读取
+func Sent(data []byte) {
+	t := typeLabel(data)
+	messagesSent.WithLabelValues(t).Inc()
+	bytesSent.WithLabelValues(t).Add(float64(len(data)))
+}
+
+// 记录收到的一条客户端消息，无法解析时 ok 为 false
+func Received(msgType byte, size int, ok bool) {
+	t := "invalid"
+	if ok {
+		t = strconv.Itoa(int(msgType))
+	}
+	messagesReceived.WithLabelValues(t).Inc()
+	bytesReceived.WithLabelValues(t).Add(float64(size))
+}
+
+func HandshakeFailed(reason string) {
+	handshakeFailures.WithLabelValues(reason).Inc()
+}
+
+func Hit(kill bool) {
+	hits.Inc()
+	if kill {
+		kills.Inc()
+	}
+}
+
+func Respawn() {
+	respawns.Inc()
+}
+
+func OriginRejected() {
+	originRejections.Inc()
+}
+
+var typePrefix = []byte(`{"type":`)
+
+func typeLabel(data []byte) string {
+	rest, ok := bytes.CutPrefix(data, typePrefix)
+	if !ok {
+		return "unknown"
+	}
+	end := bytes.IndexByte(rest, ',')
+	if end <= 0 || end > 3 {
+		return "unknown"
+	}
+	return string(rest[:end])
+}
@@ -1,8 +1,8 @@
 package model
 
 import (
-	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -10,17 +10,6 @@ import (
 
 var FlagChan = make(chan bool)
 
-const (
-	MAP_SIZE_X          uint = 1542
-	MAP_SIZE_Y          uint = 512
-	TICK_INTERVAL_MS         = 50
-	MAP_RENDER_MS            = 50
-	WAIT_REPLY_TIME          = 60
-	TANK_RELOAD_SECONDS      = 3
-) //建立链接发送数据
-
-var TANK_RELOAD_VALUE = TANK_RELOAD_SECONDS * 1000 / MAP_RENDER_MS * 5
-
 const (
 	DirUp        = 8
 	DirUpRight   = 9
@@ -38,12 +27,19 @@ const (
 	StatusTaken byte = 1
 ) //坦克状态
 
+const (
+	PhaseWarmup    byte = 0
+	PhaseCountdown byte = 1
+	PhaseLive      byte = 2
+	PhaseEnded     byte = 3
+) //比赛阶段
+
 var UP = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
-} //websocket设置
+} //websocket设置，CheckOrigin 由 main 设置为 webserver.CheckOrigin
 
+// 同时需要 ClientsMu 与 SpawnTanksMu 时，先取 ClientsMu；持有 SpawnTanksMu 时不能广播（广播会取 ClientsMu）
 var (
 	Clients       = make(map[string]*Client)
 	ClientsMu     sync.Mutex
@@ -56,6 +52,10 @@ var (
 	Usernames     []string
 	UsernameMu    sync.Mutex
 	EdgePoints    = make(map[[2]int]byte)
+	Match         MatchState
+	MatchMu       sync.Mutex
+	Spectators    = make(map[string]*Client) // 观战连接，不占用玩家名额
+	SpectatorsMu  sync.Mutex
 )
 
 type MapPoint struct {
@@ -73,16 +73,19 @@ type WebMessage struct {
 
 // 发送地图信息
 type MapConfig struct {
-	Map          []byte  `json:"map"`
-	MapSizeX     uint    `json:"map_size_x"`
-	MapSizeY     uint    `json:"map_size_y"`
-	TankCoordX   uint    `json:"tank_coord_x"`
-	TankCoordY   uint    `json:"tank_coord_y"`
-	Tankfacing   byte    `json:"tank_facing"`
-	TickInterval int     `json:"tick_interval_ms"`
-	MapRenderMS  int     `json:"map_render_ms"`
-	ServerID     string  `json:"username"`
-	Tanks        []*Tank `json:"tanks"`
+	Map          []byte         `json:"map"`
+	MapSizeX     uint           `json:"map_size_x"`
+	MapSizeY     uint           `json:"map_size_y"`
+	TankCoordX   uint           `json:"tank_coord_x"`
+	TankCoordY   uint           `json:"tank_coord_y"`
+	Tankfacing   byte           `json:"tank_facing"`
+	TickInterval int            `json:"tick_interval_ms"`
+	MapRenderMS  int            `json:"map_render_ms"`
+	ServerID     string         `json:"username"`
+	Tanks        []*Tank        `json:"tanks"`
+	Match        *MatchState    `json:"match,omitempty"`
+	ResumeToken  string         `json:"resume_token,omitempty"` // 断线重连时放入 type=16 的 resume_token
+	Chat         []*ChatMessage `json:"chat,omitempty"`         // 最近的公共聊天记录，按时间先后排列
 }
 
 // 坦克状态
@@ -96,6 +99,8 @@ type Tank struct {
 	Orientation byte   `json:"orientation"`
 	ID          string `json:"username"`
 	Point       int    `json:"point"`
+	AFK         bool   `json:"afk,omitempty"`
+	Bot         bool   `json:"bot,omitempty"`
 }
 
 // 游戏状态
@@ -103,10 +108,36 @@ type GameState struct {
 	Tanks      []*Tank      `json:"tanks"`
 	ShotEvents []*ShotEvent `json:"ShotEvents,omitempty"`
 	Map        []byte       `json:"map,omitempty"`
+	Match      *MatchState  `json:"match,omitempty"`
+	ServerTime int64        `json:"server_time_us"` // 生成本帧时的服务端时间（unix 微秒），用于测量延迟和帧间隔
 	//Items   []*Item   `json:"items,omitempty"`
 
 }
 
+// 比赛状态
+type MatchState struct {
+	Phase      byte   `json:"phase"`
+	Round      int    `json:"round"`
+	EndsAt     int64  `json:"ends_at"` // 当前阶段结束时间（unix 毫秒），0 表示不限时
+	ScoreLimit int    `json:"score_limit"`
+	MapName    string `json:"map_name"`
+}
+
+// 比赛排名
+type Standing struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Point    int    `json:"point"`
+}
+
+// 比赛结果
+type MatchResultPayload struct {
+	Round     int         `json:"round"`
+	Reason    string      `json:"reason"`
+	Winner    string      `json:"winner"`
+	Standings []*Standing `json:"standings"`
+}
+
 // 发射活动
 type ShotEvent struct {
 	Tank   string `json:"username"`
@@ -119,9 +150,21 @@ type ShotEvent struct {
 type Client struct {
 	ID         string
 	Conn       *websocket.Conn
-	Tank       *Tank
-	LastActive time.Time
+	Tank       *Tank     // 观战时为 nil（受 ClientsMu 保护）
+	LastActive time.Time // 最近一次操作时间（受 ClientsMu 保护）
+	JoinedAt   time.Time
 	WriteMutex sync.Mutex // 添加写互斥锁
+
+	ResumeToken string
+	Suspended   bool           // 连接已断开，等待重连（受 ClientsMu 保护）
+	GraceTimer  *time.Timer    // 重连超时计时器
+	Kicked      bool           // 被服务端踢出，断开后不保留会话
+	RTT         time.Duration  // 最近一次 ping/pong 往返时间
+	Dropped     int64          // 因限速被丢弃的消息数
+	Camera      *CameraPayload // 观战镜头，仅观战连接使用
+	Bot         bool           // 服务端控制的机器人，没有连接
+	RemoteAddr  string         // 客户端地址（ip:port），重连后更新
+	Team        string         // 注册时声明的队伍，为空表示不在队伍中；注册后不再改变
 }
 
 // 客户端请求
@@ -139,8 +182,25 @@ type HitPayload struct {
 }
 
 type RequestPayload struct {
+	Username    string `json:"username"`
+	Success     bool   `json:"success"`
+	Token       string `json:"token,omitempty"`        // 已注册用户名需携带登录令牌
+	ResumeToken string `json:"resume_token,omitempty"` // 断线重连时携带 type=1 中的 resume_token
+	Team        string `json:"team,omitempty"`         // 可选，队伍名，同队玩家之间可以使用队伍频道
+}
+
+type LoginPayload struct {
 	Username string `json:"username"`
-	Success  bool   `json:"success"`
+	Password string `json:"password"`
+	Register bool   `json:"register"`
+}
+
+type LoginResultPayload struct {
+	Username  string `json:"username"`
+	Success   bool   `json:"success"`
+	Token     string `json:"token,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Notice    string `json:"notice,omitempty"`
 }
 
 type NoticePayload struct {
@@ -159,5 +219,121 @@ type TankChangePayload struct {
 	Y        uint   `json:"y"`
 }
 
-// 地图数据
-var Map [MAP_SIZE_Y][MAP_SIZE_X]byte
+const (
+	CameraFree   = "free"
+	CameraFollow = "follow"
+) //观战镜头模式
+
+// 观战镜头设置（客户端发送 type=20）
+type SpectatePayload struct {
+	Mode   string `json:"mode"`
+	Target string `json:"target,omitempty"`
+	X      uint   `json:"x"`
+	Y      uint   `json:"y"`
+}
+
+// 观战镜头位置（服务端发送 type=11）
+type CameraPayload struct {
+	Mode   string `json:"mode"`
+	Target string `json:"target,omitempty"`
+	X      uint   `json:"x"`
+	Y      uint   `json:"y"`
+}
+
+// 运行参数变更（服务端发送 type=14），配置热加载或管理接口修改后发送
+type SettingsPayload struct {
+	TickInterval int `json:"tick_interval_ms"`
+	MapRenderMS  int `json:"map_render_ms"`
+}
+
+const (
+	ChatAll     = "all"
+	ChatTeam    = "team"
+	ChatWhisper = "whisper"
+) //聊天频道
+
+// 聊天（客户端发送 type=22）
+type ChatPayload struct {
+	Channel string `json:"channel"`
+	To      string `json:"to,omitempty"` // whisper 的接收者
+	Text    string `json:"text"`
+}
+
+// 聊天消息（服务端发送 type=13）
+type ChatMessage struct {
+	From    string `json:"from"`
+	Channel string `json:"channel"`
+	To      string `json:"to,omitempty"`
+	Team    string `json:"team,omitempty"` // 队伍频道时为发送者的队伍
+	Text    string `json:"text"`
+	Time    int64  `json:"time"` // unix 毫秒
+}
+
+const (
+	ReplayPlay  = "play"
+	ReplayPause = "pause"
+	ReplaySeek  = "seek"
+	ReplaySpeed = "speed"
+) //回放控制
+
+// 回放控制（客户端发送 type=21）
+type ReplayControlPayload struct {
+	Action string  `json:"action"`
+	At     int64   `json:"at,omitempty"`    // seek 的目标位置（毫秒）
+	Speed  float64 `json:"speed,omitempty"` // speed 的播放倍速
+}
+
+// 回放状态（服务端发送 type=12）
+type ReplayStatusPayload struct {
+	Name       string  `json:"name"`
+	Round      int     `json:"round"`
+	MapName    string  `json:"map_name"`
+	DurationMS int64   `json:"duration_ms"`
+	PositionMS int64   `json:"position_ms"`
+	Playing    bool    `json:"playing"`
+	Speed      float64 `json:"speed"`
+	Ended      bool    `json:"ended"`
+}
+
+// 地图数据 Map[y][x]，尺寸由 game.map_size_x/map_size_y 决定，生成或载入地图时分配。
+// 启动后换图会替换 Map 与尺寸，读写都需持有 SpawnTanksMu
+var (
+	Map      [][]byte
+	MapSizeX uint
+	MapSizeY uint
+)
+
+// 当前地图尺寸，调用方不能持有 SpawnTanksMu
+func MapSize() (uint, uint) {
+	SpawnTanksMu.Lock()
+	defer SpawnTanksMu.Unlock()
+	return MapSizeX, MapSizeY
+}
+
+// 按尺寸分配空白地图，尺寸不变时只清空；调用方需持有 SpawnTanksMu（启动时除外）
+func ResizeMap(x, y uint) {
+	if x == MapSizeX && y == MapSizeY {
+		for _, row := range Map {
+			clear(row)
+		}
+		return
+	}
+	cells := make([]byte, x*y)
+	rows := make([][]byte, y)
+	for i := range rows {
+		rows[i] = cells[uint(i)*x : uint(i+1)*x]
+	}
+	Map, MapSizeX, MapSizeY = rows, x, y
+}
+
+// 地形版本，每次生成或载入地图后递增，供寻路等缓存判断是否需要重建
+var MapVersion atomic.Uint64
+
+// 当前广播间隔（毫秒），初始为 game.tick_interval_ms，可由管理接口在运行中修改
+var TickIntervalMS atomic.Int64
+
+func init() {
+	g := DefaultSettings().Game
+	TickIntervalMS.Store(int64(g.TickIntervalMS))
+	ResizeMap(g.MapSizeX, g.MapSizeY)
+}
@@ -0,0 +1,330 @@
+package model
+
+import "sync/atomic"
+
+// 游戏配置（config.json 中除端口与路径外的部分）
+type Settings struct {
+	Game      GameConfig      `json:"game"`
+	Network   NetworkConfig   `json:"network"`
+	MapGen    MapGenConfig    `json:"map_gen"`
+	Match     MatchConfig     `json:"match"`
+	Stats     StatsConfig     `json:"stats"`
+	Auth      AuthConfig      `json:"auth"`
+	Session   SessionConfig   `json:"session"`
+	Idle      IdleConfig      `json:"idle"`
+	Heartbeat HeartbeatConfig `json:"heartbeat"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Username  UsernameConfig  `json:"username"`
+	Replay    ReplayConfig    `json:"replay"`
+	Bots      BotsConfig      `json:"bots"`
+	Log       LogConfig       `json:"log"`
+	Admin     AdminConfig     `json:"admin"`
+	Chat      ChatConfig      `json:"chat"`
+	Origins   OriginsConfig   `json:"origins"`
+
+	ConfigReload ConfigReloadConfig `json:"config_reload"`
+	Shutdown     ShutdownConfig     `json:"shutdown"`
+}
+
+// 游戏参数
+type GameConfig struct {
+	MapSizeX       uint `json:"map_size_x"`       // 地图宽度（格）
+	MapSizeY       uint `json:"map_size_y"`       // 地图高度（格）
+	TickIntervalMS int  `json:"tick_interval_ms"` // type=2 广播间隔
+	MapRenderMS    int  `json:"map_render_ms"`    // 移动、子弹与装填的步进间隔
+	ReloadSeconds  int  `json:"reload_seconds"`   // 开火后的装填时间
+}
+
+// 网络参数
+type NetworkConfig struct {
+	HandshakeTimeoutSeconds int `json:"handshake_timeout_seconds"` // 连接后等待 type=16 的时间
+	ReadBufferSize          int `json:"read_buffer_size"`          // websocket 读缓冲（字节）
+	WriteBufferSize         int `json:"write_buffer_size"`         // websocket 写缓冲（字节）
+}
+
+// 随机地图生成参数
+type MapGenConfig struct {
+	Seed            int64   `json:"seed"`            // 随机种子，相同种子与参数生成相同的地图序列，0 表示每次启动随机
+	PointSpacing    float64 `json:"point_spacing"`   // 河流与树林起点之间的最小距离（泊松盘采样半径）
+	PointAttempts   int     `json:"point_attempts"`  // 泊松盘采样每个点的尝试次数
+	RiverRatio      float64 `json:"river_ratio"`     // 起点为河流的概率，其余为树林
+	RiverStepsMin   int     `json:"river_steps_min"` // 河流长度（步），在 min~max 之间随机
+	RiverStepsMax   int     `json:"river_steps_max"`
+	TreeRatio       float64 `json:"tree_ratio"`     // 树林按扩散生成的概率，其余为圆形
+	TreeStepsMin    int     `json:"tree_steps_min"` // 扩散树林的扩散层数，在 min~max 之间随机
+	TreeStepsMax    int     `json:"tree_steps_max"`
+	CircleRadiusMin int     `json:"circle_radius_min"` // 圆形树林的半径（格），在 min~max 之间随机
+	CircleRadiusMax int     `json:"circle_radius_max"`
+}
+
+// 比赛配置
+type MatchConfig struct {
+	WarmupSeconds    int      `json:"warmup_seconds"`
+	MinPlayers       int      `json:"min_players"`
+	CountdownSeconds int      `json:"countdown_seconds"`
+	TimeLimitSeconds int      `json:"time_limit_seconds"` // 0 表示不限时
+	ScoreLimit       int      `json:"score_limit"`        // 0 表示不限分
+	ResultsSeconds   int      `json:"results_seconds"`
+	MapRotation      []string `json:"map_rotation"` // 地图文件列表，为空则每局随机生成
+}
+
+// 玩家统计配置
+type StatsConfig struct {
+	DBPath       string `json:"db_path"` // 为空则不记录统计
+	FlushSeconds int    `json:"flush_seconds"`
+}
+
+// 账号配置
+type AuthConfig struct {
+	DBPath        string `json:"db_path"` // 为空则关闭账号功能
+	Secret        string `json:"secret"`  // 令牌签名密钥，为空时自动生成并保存在账号数据库中
+	TokenTTLHours int    `json:"token_ttl_hours"`
+	AllowGuests   bool   `json:"allow_guests"`
+	GuestPrefix   string `json:"guest_prefix"` // 非空时游客名字必须以此开头
+}
+
+// 断线重连配置
+type SessionConfig struct {
+	GraceSeconds int `json:"grace_seconds"` // 断线后保留坦克的时间，0 表示立即释放
+}
+
+// 挂机检测配置
+type IdleConfig struct {
+	AFKSeconds  int    `json:"afk_seconds"`  // 无操作多久后标记为挂机，0 表示不检测
+	KickSeconds int    `json:"kick_seconds"` // 无操作多久后执行 action，0 表示不处理
+	Action      string `json:"action"`       // "spectate"=转为观战，"disconnect"=断开连接
+}
+
+const (
+	IdleActionSpectate   = "spectate"
+	IdleActionDisconnect = "disconnect"
+)
+
+// 心跳配置
+type HeartbeatConfig struct {
+	PingIntervalSeconds int `json:"ping_interval_seconds"` // 0 表示不发送 ping
+	PongTimeoutSeconds  int `json:"pong_timeout_seconds"`  // 超过该时间未收到 pong 或消息即断开
+}
+
+// 客户端消息限速配置
+type RateLimitConfig struct {
+	Frame          BucketConfig `json:"frame"`            // 所有消息，在解析之前计数
+	Move           BucketConfig `json:"move"`             // type=15
+	Fire           BucketConfig `json:"fire"`             // action 为 fire 的 type=15
+	Hit            BucketConfig `json:"hit"`              // type=17
+	Respawn        BucketConfig `json:"respawn"`          // type=18
+	Chat           BucketConfig `json:"chat"`             // type=22
+	KickAfterDrops int          `json:"kick_after_drops"` // 窗口内丢弃超过该数量即断开，0 表示不断开
+	WindowSeconds  int          `json:"window_seconds"`
+
+	Login              BucketConfig `json:"login"`                 // 握手阶段的 type=19，每个连接
+	LoginFailuresPerIP BucketConfig `json:"login_failures_per_ip"` // 每个 IP 的登录失败次数，耗尽后该 IP 的登录在校验密码前直接拒绝
+	MaxLoginFailures   int          `json:"max_login_failures"`    // 单个连接登录失败达到该次数即断开，0 表示不断开
+}
+
+// 令牌桶：每秒补充 rate 个，最多积攒 burst 个；rate 为 0 表示不限速
+type BucketConfig struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// 用户名规则
+type UsernameConfig struct {
+	MinLength      int      `json:"min_length"` // 按字符（rune）计数
+	MaxLength      int      `json:"max_length"`
+	AllowedClasses []string `json:"allowed_classes"` // letter/latin/digit/cjk/underscore/hyphen/dot/space，为空表示不限制
+	Reserved       []string `json:"reserved"`        // 保留字，规范化后比较
+}
+
+// 比赛回放配置
+type ReplayConfig struct {
+	Dir      string `json:"dir"`       // 回放文件目录，为空则不录制
+	MaxFiles int    `json:"max_files"` // 最多保留的回放数量，超出时删除最旧的，0 表示不限
+}
+
+// 机器人配置
+type BotsConfig struct {
+	MinPlayers     int    `json:"min_players"` // 有真人在线时用机器人补足到该人数，0 表示不添加机器人
+	NamePrefix     string `json:"name_prefix"`
+	FireRange      int    `json:"fire_range"` // 开火距离（格）
+	RespawnSeconds int    `json:"respawn_seconds"`
+}
+
+// 聊天配置
+type ChatConfig struct {
+	Enabled     bool     `json:"enabled"`
+	MaxLength   int      `json:"max_length"`   // 按字符（rune）计数
+	HistorySize int      `json:"history_size"` // type=1 中携带的公共聊天条数，0 表示不保留
+	FilterWords []string `json:"filter_words"` // 屏蔽词，不区分大小写，替换为 *
+}
+
+// websocket 升级时允许的 Origin，不带 Origin 的请求（非浏览器客户端）与同源页面总是允许
+type OriginsConfig struct {
+	Allowed  []string `json:"allowed"`   // 如 https://portal.example.com、https://*.example.com、http://localhost:*，* 匹配除 / 外的任意字符
+	AllowAll bool     `json:"allow_all"` // 允许任意 Origin，仅用于开发
+}
+
+// 配置热加载
+type ConfigReloadConfig struct {
+	PollSeconds int `json:"poll_seconds"` // 检查配置文件是否修改的间隔，0 表示只通过管理接口加载
+}
+
+// 优雅关闭
+type ShutdownConfig struct {
+	Notice         string `json:"notice"`          // 关闭前以 type=0 发给所有连接，同时作为 websocket 关闭帧的原因
+	TimeoutSeconds int    `json:"timeout_seconds"` // 等待连接断开与请求结束的最长时间
+}
+
+// 日志配置
+type LogConfig struct {
+	Format     string            `json:"format"`     // "text" 或 "json"
+	Level      string            `json:"level"`      // debug/info/warn/error，未单独配置的子系统使用此级别
+	Subsystems map[string]string `json:"subsystems"` // 子系统级别，如 network/game/map
+}
+
+// 管理接口配置
+type AdminConfig struct {
+	Token    string `json:"token"`     // 请求头 Authorization: Bearer <token>，为空则关闭管理接口
+	AuditLog string `json:"audit_log"` // 审计日志文件（JSON Lines），为空则只写入普通日志
+	BansFile string `json:"bans_file"` // 封禁列表文件，为空则封禁只保存在内存中
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// 默认配置
+func DefaultSettings() Settings {
+	return Settings{
+		Game: GameConfig{
+			MapSizeX:       1542,
+			MapSizeY:       512,
+			TickIntervalMS: 50,
+			MapRenderMS:    50,
+			ReloadSeconds:  3,
+		},
+		Network: NetworkConfig{
+			HandshakeTimeoutSeconds: 60,
+			ReadBufferSize:          1024,
+			WriteBufferSize:         1024,
+		},
+		MapGen: MapGenConfig{
+			PointSpacing:    175,
+			PointAttempts:   100,
+			RiverRatio:      0.7,
+			RiverStepsMin:   100,
+			RiverStepsMax:   300,
+			TreeRatio:       0.5,
+			TreeStepsMin:    50,
+			TreeStepsMax:    60,
+			CircleRadiusMin: 50,
+			CircleRadiusMax: 60,
+		},
+		Match: MatchConfig{
+			WarmupSeconds:    30,
+			MinPlayers:       1,
+			CountdownSeconds: 5,
+			TimeLimitSeconds: 600,
+			ScoreLimit:       20,
+			ResultsSeconds:   10,
+		},
+		Stats: StatsConfig{
+			DBPath:       "stats.db",
+			FlushSeconds: 5,
+		},
+		Auth: AuthConfig{
+			DBPath:        "accounts.db",
+			TokenTTLHours: 168,
+			AllowGuests:   true,
+		},
+		Session: SessionConfig{
+			GraceSeconds: 30,
+		},
+		Idle: IdleConfig{
+			AFKSeconds:  60,
+			KickSeconds: 300,
+			Action:      IdleActionSpectate,
+		},
+		Heartbeat: HeartbeatConfig{
+			PingIntervalSeconds: 10,
+			PongTimeoutSeconds:  30,
+		},
+		RateLimit: RateLimitConfig{
+			Frame:          BucketConfig{Rate: 40, Burst: 80},
+			Move:           BucketConfig{Rate: 20, Burst: 40},
+			Fire:           BucketConfig{Rate: 2, Burst: 4},
+			Hit:            BucketConfig{Rate: 5, Burst: 10},
+			Respawn:        BucketConfig{Rate: 1, Burst: 3},
+			Chat:           BucketConfig{Rate: 0.5, Burst: 5},
+			KickAfterDrops: 200,
+			WindowSeconds:  10,
+
+			Login:              BucketConfig{Rate: 0.5, Burst: 3},
+			LoginFailuresPerIP: BucketConfig{Rate: 0.1, Burst: 10},
+			MaxLoginFailures:   5,
+		},
+		Username: UsernameConfig{
+			MinLength:      1,
+			MaxLength:      20,
+			AllowedClasses: []string{"latin", "digit", "cjk", "underscore", "hyphen"},
+			Reserved:       []string{"admin", "administrator", "server", "system", "moderator"},
+		},
+		Replay: ReplayConfig{
+			Dir:      "replays",
+			MaxFiles: 50,
+		},
+		Bots: BotsConfig{
+			MinPlayers:     4,
+			NamePrefix:     "bot-",
+			FireRange:      200,
+			RespawnSeconds: 3,
+		},
+		Log: LogConfig{
+			Format: LogFormatText,
+			Level:  "info",
+			Subsystems: map[string]string{
+				"network": "info",
+				"game":    "info",
+				"map":     "info",
+			},
+		},
+		Chat: ChatConfig{
+			Enabled:     true,
+			MaxLength:   200,
+			HistorySize: 20,
+			FilterWords: []string{},
+		},
+		Origins: OriginsConfig{
+			Allowed: []string{},
+		},
+		Admin: AdminConfig{
+			AuditLog: "admin_audit.log",
+			BansFile: "bans.json",
+		},
+		ConfigReload: ConfigReloadConfig{
+			PollSeconds: 2,
+		},
+		Shutdown: ShutdownConfig{
+			Notice:         "server is shutting down",
+			TimeoutSeconds: 10,
+		},
+	}
+}
+
+var settings atomic.Pointer[Settings]
+
+func init() {
+	s := DefaultSettings()
+	settings.Store(&s)
+}
+
+// 获取当前配置
+func Conf() *Settings {
+	return settings.Load()
+}
+
+// 写入配置
+func SetConf(s Settings) {
+	settings.Store(&s)
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"slices"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// 用户名字符类别，username.allowed_classes 的取值
+var UsernameClasses = map[string]func(rune) bool{
+	"letter": unicode.IsLetter,
+	"latin":  func(r rune) bool { return unicode.Is(unicode.Latin, r) },
+	"digit":  unicode.IsDigit,
+	"cjk": func(r rune) bool {
+		return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+	},
+	"underscore": func(r rune) bool { return r == '_' },
+	"hyphen":     func(r rune) bool { return r == '-' },
+	"dot":        func(r rune) bool { return r == '.' },
+	"space":      func(r rune) bool { return r == ' ' },
+}
+
+var foldCaser = cases.Fold()
+
+// 规范化用户名：NFKC 合并全角/兼容字符后再做大小写折叠，用于查重、保留字比较与账号的键
+func NormalizeUsername(username string) string {
+	return foldCaser.String(norm.NFKC.String(username))
+}
+
+// 已知的字符类别名，按字母排序
+func usernameClassNames() []string {
+	names := make([]string, 0, len(UsernameClasses))
+	for name := range UsernameClasses {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// 广播间隔的取值范围，配置文件与管理接口共用
+const (
+	MinTickIntervalMS = 10
+	MaxTickIntervalMS = 1000
+)
+
+// 校验配置，返回所有不合法的字段；日志配置由 logging.Validate 校验
+func (s Settings) Validate() error {
+	var v validator
+
+	g := s.Game
+	v.rangeInt("game.map_size_x", int(g.MapSizeX), 64, 8192)
+	v.rangeInt("game.map_size_y", int(g.MapSizeY), 64, 8192)
+	v.rangeInt("game.tick_interval_ms", g.TickIntervalMS, MinTickIntervalMS, MaxTickIntervalMS)
+	v.rangeInt("game.map_render_ms", g.MapRenderMS, 10, 1000)
+	v.rangeInt("game.reload_seconds", g.ReloadSeconds, 0, 60)
+
+	n := s.Network
+	v.rangeInt("network.handshake_timeout_seconds", n.HandshakeTimeoutSeconds, 1, 600)
+	v.rangeInt("network.read_buffer_size", n.ReadBufferSize, 256, 1<<20)
+	v.rangeInt("network.write_buffer_size", n.WriteBufferSize, 256, 1<<20)
+
+	mg := s.MapGen
+	if shorter := float64(min(g.MapSizeX, g.MapSizeY)); mg.PointSpacing < 10 || mg.PointSpacing > shorter {
+		v.add("map_gen.point_spacing must be between 10 and the shorter map side (%g), got %g", shorter, mg.PointSpacing)
+	}
+	v.rangeInt("map_gen.point_attempts", mg.PointAttempts, 1, 1000)
+	v.ratio("map_gen.river_ratio", mg.RiverRatio)
+	v.ratio("map_gen.tree_ratio", mg.TreeRatio)
+	v.span("map_gen.river_steps", mg.RiverStepsMin, mg.RiverStepsMax, 1, 10000)
+	v.span("map_gen.tree_steps", mg.TreeStepsMin, mg.TreeStepsMax, 1, 1000)
+	v.span("map_gen.circle_radius", mg.CircleRadiusMin, mg.CircleRadiusMax, 1, 1000)
+
+	m := s.Match
+	v.nonNegative("match.warmup_seconds", m.WarmupSeconds)
+	v.nonNegative("match.min_players", m.MinPlayers)
+	v.nonNegative("match.countdown_seconds", m.CountdownSeconds)
+	v.nonNegative("match.time_limit_seconds", m.TimeLimitSeconds)
+	v.nonNegative("match.score_limit", m.ScoreLimit)
+	v.nonNegative("match.results_seconds", m.ResultsSeconds)
+
+	if s.Stats.DBPath != "" {
+		v.rangeInt("stats.flush_seconds", s.Stats.FlushSeconds, 1, 3600)
+	}
+	if s.Auth.DBPath != "" {
+		v.rangeInt("auth.token_ttl_hours", s.Auth.TokenTTLHours, 1, 24*365)
+	}
+	v.nonNegative("session.grace_seconds", s.Session.GraceSeconds)
+
+	v.nonNegative("idle.afk_seconds", s.Idle.AFKSeconds)
+	v.nonNegative("idle.kick_seconds", s.Idle.KickSeconds)
+	switch s.Idle.Action {
+	case IdleActionSpectate, IdleActionDisconnect:
+	default:
+		v.add("idle.action must be %q or %q, got %q", IdleActionSpectate, IdleActionDisconnect, s.Idle.Action)
+	}
+
+	hb := s.Heartbeat
+	v.nonNegative("heartbeat.ping_interval_seconds", hb.PingIntervalSeconds)
+	v.nonNegative("heartbeat.pong_timeout_seconds", hb.PongTimeoutSeconds)
+	if hb.PingIntervalSeconds > 0 && hb.PongTimeoutSeconds > 0 && hb.PongTimeoutSeconds <= hb.PingIntervalSeconds {
+		v.add("heartbeat.pong_timeout_seconds must be greater than ping_interval_seconds (%d), got %d", hb.PingIntervalSeconds, hb.PongTimeoutSeconds)
+	}
+
+	rl := s.RateLimit
+	for _, b := range []struct {
+		name string
+		BucketConfig
+	}{{"frame", rl.Frame}, {"move", rl.Move}, {"fire", rl.Fire}, {"hit", rl.Hit}, {"respawn", rl.Respawn}, {"chat", rl.Chat},
+		{"login", rl.Login}, {"login_failures_per_ip", rl.LoginFailuresPerIP}} {
+		if b.Rate < 0 {
+			v.add("rate_limit.%s.rate must not be negative, got %g", b.name, b.Rate)
+		}
+		if b.Rate > 0 && b.Burst < 1 {
+			v.add("rate_limit.%s.burst must be at least 1 when rate is set, got %d", b.name, b.Burst)
+		}
+	}
+	v.nonNegative("rate_limit.kick_after_drops", rl.KickAfterDrops)
+	v.nonNegative("rate_limit.max_login_failures", rl.MaxLoginFailures)
+	if rl.KickAfterDrops > 0 {
+		v.rangeInt("rate_limit.window_seconds", rl.WindowSeconds, 1, 3600)
+	}
+
+	u := s.Username
+	v.nonNegative("username.min_length", u.MinLength)
+	v.nonNegative("username.max_length", u.MaxLength)
+	if u.MaxLength > 0 && u.MaxLength < u.MinLength {
+		v.add("username.max_length (%d) must not be less than min_length (%d)", u.MaxLength, u.MinLength)
+	}
+	for _, c := range u.AllowedClasses {
+		if _, ok := UsernameClasses[c]; !ok {
+			v.add("username.allowed_classes entry %q must be one of %s", c, strings.Join(usernameClassNames(), ", "))
+		}
+	}
+
+	v.nonNegative("replay.max_files", s.Replay.MaxFiles)
+
+	b := s.Bots
+	v.nonNegative("bots.min_players", b.MinPlayers)
+	if b.MinPlayers > 0 {
+		if b.NamePrefix == "" {
+			v.add("bots.name_prefix must not be empty when bots are enabled")
+		}
+		v.rangeInt("bots.fire_range", b.FireRange, 1, 8192)
+		v.nonNegative("bots.respawn_seconds", b.RespawnSeconds)
+	}
+
+	v.nonNegative("chat.max_length", s.Chat.MaxLength)
+	v.rangeInt("chat.history_size", s.Chat.HistorySize, 0, 1000)
+
+	for _, p := range s.Origins.Allowed {
+		if _, err := path.Match(p, ""); err != nil || (p != "null" && !strings.Contains(p, "://")) {
+			v.add("origins.allowed entry %q must look like scheme://host[:port] (or \"null\")", p)
+		}
+	}
+
+	v.rangeInt("config_reload.poll_seconds", s.ConfigReload.PollSeconds, 0, 3600)
+
+	// 关闭帧的载荷最多 125 字节，其中 2 字节为关闭码
+	if n := len(s.Shutdown.Notice); n == 0 || n > 123 {
+		v.add("shutdown.notice must be 1 to 123 bytes, got %d", n)
+	}
+	v.rangeInt("shutdown.timeout_seconds", s.Shutdown.TimeoutSeconds, 1, 300)
+
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) rangeInt(name string, val, lo, hi int) {
+	if val < lo || val > hi {
+		v.add("%s must be between %d and %d, got %d", name, lo, hi, val)
+	}
+}
+
+func (v *validator) nonNegative(name string, val int) {
+	if val < 0 {
+		v.add("%s must not be negative, got %d", name, val)
+	}
+}
+
+func (v *validator) ratio(name string, val float64) {
+	if val < 0 || val > 1 {
+		v.add("%s must be between 0 and 1, got %g", name, val)
+	}
+}
+
+// name_min 与 name_max 都在 [floor, ceil] 内且 min <= max
+func (v *validator) span(name string, lo, hi, floor, ceil int) {
+	v.rangeInt(name+"_min", lo, floor, ceil)
+	v.rangeInt(name+"_max", hi, floor, ceil)
+	if lo > hi {
+		v.add("%s_min (%d) must not be greater than %s_max (%d)", name, lo, name, hi)
+	}
+}
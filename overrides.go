@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 命令行参数，优先级：默认值 < 配置文件 < TANK_* 环境变量 < 命令行参数
+var (
+	flagConfig      = flag.String("config", "config.json", "配置文件路径")
+	flagPort        = flag.Int("port", 0, "监听端口，覆盖 server_port")
+	flagMapFile     = flag.String("map-file", "", "每局都载入该地图文件，覆盖 match.map_rotation")
+	flagSeed        = flag.Int64("seed", 0, "随机地图种子，覆盖 map_gen.seed")
+	flagLogLevel    = flag.String("log-level", "", "日志级别，覆盖 log.level")
+	flagAdminToken  = flag.String("admin-token", "", "管理接口令牌，覆盖 admin.token")
+	flagPrintConfig = flag.Bool("print-config", false, "输出合并后的配置并退出")
+)
+
+const envPrefix = "TANK_"
+
+func parseFlags() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "用法: %s [参数]\n\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(out, "\n配置文件中的每个字段都可以用环境变量覆盖，名字为 %s 加上大写的字段路径，例如\n", envPrefix)
+		fmt.Fprintf(out, "  %sSERVER_PORT=9000 %sGAME_TICK_INTERVAL_MS=100 %sLOG_SUBSYSTEMS=game=debug,network=info\n", envPrefix, envPrefix, envPrefix)
+	}
+	flag.Parse()
+	configPath = *flagConfig
+}
+
+// 在配置文件之上依次应用环境变量与命令行参数，热加载时同样生效
+func applyOverrides(cfg *Config) error {
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), envPrefix); err != nil {
+		return err
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.ServerPort = *flagPort
+		case "map-file":
+			cfg.Match.MapRotation = []string{*flagMapFile}
+		case "seed":
+			cfg.MapGen.Seed = *flagSeed
+		case "log-level":
+			cfg.Log.Level = *flagLogLevel
+		case "admin-token":
+			cfg.Admin.Token = *flagAdminToken
+		}
+	})
+	return nil
+}
+
+// 按 json 标签把字段映射为环境变量，如 game.map_size_x -> TANK_GAME_MAP_SIZE_X
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			// 内嵌的 model.Settings 在 JSON 中是平铺的
+			if err := applyEnv(v.Field(i), prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + strings.ToUpper(name)
+		if f.Type.Kind() == reflect.Struct {
+			if err := applyEnv(v.Field(i), key+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(v.Field(i), raw); err != nil {
+			return fmt.Errorf("%s=%q: %w", key, raw, err)
+		}
+	}
+	return nil
+}
+
+// 字符串列表以逗号分隔，map 为 k=v 逗号分隔，也可以直接写 JSON
+func setFromEnv(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice, reflect.Map:
+		if trimmed := strings.TrimSpace(raw); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+			// 整体替换配置文件中的值，而不是与之合并
+			v.Set(reflect.Zero(v.Type()))
+			return json.Unmarshal([]byte(trimmed), v.Addr().Interface())
+		}
+		return setListFromEnv(v, raw)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func setListFromEnv(v reflect.Value, raw string) error {
+	items := []string{}
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	if v.Kind() == reflect.Slice {
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+		return nil
+	}
+	if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	m := reflect.MakeMapWithSize(v.Type(), len(items))
+	for _, item := range items {
+		k, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", item)
+		}
+		m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), reflect.ValueOf(strings.TrimSpace(val)))
+	}
+	v.Set(m)
+	return nil
+}
+
+// --print-config：输出合并后的配置，隐藏密钥
+func printConfig(cfg Config) error {
+	if cfg.Admin.Token != "" {
+		cfg.Admin.Token = "<redacted>"
+	}
+	if cfg.Auth.Secret != "" {
+		cfg.Auth.Secret = "<redacted>"
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
@@ -0,0 +1,371 @@
+package pathfind
+
+import (
+	"sync"
+
+	"example.com/lite_demo/model"
+)
+
+// 默认导航网格：每个粗格 4x4。服务端的坦克只占中心所在的一个细格：
+// MarkTankOnMap 只标记该格，moveTank 也只检查目标格（斜向时再看两侧），
+// 客户端绘制的车身不参与碰撞，所以半径取 0 与实际移动规则一致，不会规划出走不通的路径
+const (
+	DefaultCell   = 4
+	DefaultRadius = 0
+)
+
+const (
+	costStraight = 10
+	costDiagonal = 14 // ≈ 10·√2
+	snapRange    = 3  // 起点或终点所在粗格不可通行时，向外找可通行粗格的范围
+)
+
+// 地图坐标
+type Point struct {
+	X, Y int
+}
+
+// 粗粒度导航网格。粗格内所有细格都能容纳坦克时才可通行，
+// 因此沿粗格走出的路径在细格上一定可以通过。
+type Grid struct {
+	Cell    int    // 粗格边长（细格数）
+	Radius  int    // 坦克半径：坦克中心周围 Radius 格内不能有地形
+	Version uint64 // 建立时的 model.MapVersion
+	sx, sy  int    // 建立时的地图尺寸（细格）
+	w, h    int
+	open    []bool
+	region  []int32 // 连通区域编号，不同区域之间不可达，-1 表示不可通行
+}
+
+// 按当前 model.Map 建立导航网格，只考虑河流和树林，不考虑坦克。
+// 在 SpawnTanksMu 下复制地形后再计算，调用方不能持有该锁
+func NewGrid(cell, radius int) *Grid {
+	if cell < 1 {
+		cell = 1
+	}
+	model.SpawnTanksMu.Lock()
+	sx, sy := int(model.MapSizeX), int(model.MapSizeY)
+	version := model.MapVersion.Load()
+	terrain := make([]byte, 0, sx*sy)
+	for _, row := range model.Map {
+		terrain = append(terrain, row...)
+	}
+	model.SpawnTanksMu.Unlock()
+
+	g := &Grid{
+		Cell:    cell,
+		Radius:  radius,
+		Version: version,
+		sx:      sx,
+		sy:      sy,
+		w:       (sx + cell - 1) / cell,
+		h:       (sy + cell - 1) / cell,
+	}
+	g.open = make([]bool, g.w*g.h)
+
+	// 先算出每个细格能否容纳坦克中心
+	fits := make([]bool, sx*sy)
+	for y := 0; y < sy; y++ {
+		for x := 0; x < sx; x++ {
+			fits[y*sx+x] = footprintClear(terrain, sx, sy, x, y, radius)
+		}
+	}
+	for cy := 0; cy < g.h; cy++ {
+		for cx := 0; cx < g.w; cx++ {
+			open := true
+			for y := cy * cell; y < min((cy+1)*cell, sy) && open; y++ {
+				for x := cx * cell; x < min((cx+1)*cell, sx); x++ {
+					if !fits[y*sx+x] {
+						open = false
+						break
+					}
+				}
+			}
+			g.open[cy*g.w+cx] = open
+		}
+	}
+	g.labelRegions()
+	return g
+}
+
+// 标记连通区域，不可达的查询无需搜索整个区域
+func (g *Grid) labelRegions() {
+	g.region = make([]int32, len(g.open))
+	for i := range g.region {
+		g.region[i] = -1
+	}
+	var next int32
+	var stack []int
+	for i, open := range g.open {
+		if !open || g.region[i] >= 0 {
+			continue
+		}
+		g.region[i] = next
+		stack = append(stack[:0], i)
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			cx, cy := cur%g.w, cur/g.w
+			for _, d := range neighbors {
+				ni := (cy+d[1])*g.w + cx + d[0]
+				if g.canStep(cx, cy, d[0], d[1]) && g.region[ni] < 0 {
+					g.region[ni] = next
+					stack = append(stack, ni)
+				}
+			}
+		}
+		next++
+	}
+}
+
+// 坦克中心位于 (x,y) 时占用的格子都在地图内且没有地形，terrain 为按行展开的 sx*sy 地形
+func footprintClear(terrain []byte, sx, sy, x, y, radius int) bool {
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			nx, ny := x+dx, y+dy
+			if nx < 0 || ny < 0 || nx >= sx || ny >= sy {
+				return false
+			}
+			if v := terrain[ny*sx+nx]; v == 2 || v == 3 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (g *Grid) passable(cx, cy int) bool {
+	return cx >= 0 && cy >= 0 && cx < g.w && cy < g.h && g.open[cy*g.w+cx]
+}
+
+// 与 moveTank 相同的规则：目标格不可通行，或斜向移动时两侧都不可通行，则不能移动
+func (g *Grid) canStep(cx, cy, dx, dy int) bool {
+	if !g.passable(cx+dx, cy+dy) {
+		return false
+	}
+	if dx != 0 && dy != 0 {
+		return g.passable(cx+dx, cy) || g.passable(cx, cy+dy)
+	}
+	return true
+}
+
+var neighbors = [8][2]int{
+	{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1},
+}
+
+// 查找从 from 到 to 的路径，返回途经点（细格坐标，最后一个为 to），不可达时返回 nil。
+// 途经点之间是直线或 45° 斜线，相邻途经点不同向。
+func (g *Grid) Find(from, to Point) []Point {
+	sx, sy, ok := g.snap(from)
+	if !ok {
+		return nil
+	}
+	gx, gy, ok := g.snap(to)
+	if !ok {
+		return nil
+	}
+	start, goal := sy*g.w+sx, gy*g.w+gx
+	if start == goal {
+		return []Point{to}
+	}
+	if g.region[start] != g.region[goal] {
+		return nil
+	}
+
+	s := getScratch(g.w * g.h)
+	defer scratchPool.Put(s)
+	cost, came := s.cost, s.came
+	cost[start] = 0
+	came[start] = int32(start)
+
+	h0 := int32(g.heuristic(sx, sy, gx, gy))
+	open := &s.open
+	open.push(node{idx: int32(start), f: h0, h: h0})
+	for len(*open) > 0 {
+		cur := open.pop()
+		idx := int(cur.idx)
+		if idx == goal {
+			return g.buildPath(came, start, goal, to)
+		}
+		cx, cy := idx%g.w, idx/g.w
+		if cur.f-cur.h > cost[idx] {
+			// 已有更短的路径，跳过过期的堆节点
+			continue
+		}
+		for _, d := range neighbors {
+			if !g.canStep(cx, cy, d[0], d[1]) {
+				continue
+			}
+			step := costStraight
+			if d[0] != 0 && d[1] != 0 {
+				step = costDiagonal
+			}
+			nx, ny := cx+d[0], cy+d[1]
+			ni := ny*g.w + nx
+			nc := cost[idx] + int32(step)
+			if cost[ni] >= 0 && cost[ni] <= nc {
+				continue
+			}
+			cost[ni] = nc
+			came[ni] = int32(idx)
+			h := int32(g.heuristic(nx, ny, gx, gy))
+			open.push(node{idx: int32(ni), f: nc + h, h: h})
+		}
+	}
+	return nil
+}
+
+// 八方向距离估价
+func (g *Grid) heuristic(x, y, gx, gy int) int {
+	dx, dy := abs(x-gx), abs(y-gy)
+	return costStraight*max(dx, dy) + (costDiagonal-costStraight)*min(dx, dy)
+}
+
+// 把细格坐标映射到粗格，所在粗格不可通行时就近找一个可通行的
+func (g *Grid) snap(p Point) (int, int, bool) {
+	cx, cy := p.X/g.Cell, p.Y/g.Cell
+	if g.passable(cx, cy) {
+		return cx, cy, true
+	}
+	for r := 1; r <= snapRange; r++ {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if max(abs(dx), abs(dy)) == r && g.passable(cx+dx, cy+dy) {
+					return cx + dx, cy + dy, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// 回溯路径，只保留转向处的粗格中心
+func (g *Grid) buildPath(came []int32, start, goal int, to Point) []Point {
+	var cells []int
+	for i := goal; i != start; i = int(came[i]) {
+		cells = append(cells, i)
+	}
+	cells = append(cells, start)
+
+	var path []Point
+	prevDX, prevDY := 0, 0
+	for i := len(cells) - 1; i > 0; i-- {
+		ax, ay := cells[i]%g.w, cells[i]/g.w
+		bx, by := cells[i-1]%g.w, cells[i-1]/g.w
+		dx, dy := bx-ax, by-ay
+		if i < len(cells)-1 && (dx != prevDX || dy != prevDY) {
+			path = append(path, g.center(ax, ay))
+		}
+		prevDX, prevDY = dx, dy
+	}
+	return append(path, to)
+}
+
+func (g *Grid) center(cx, cy int) Point {
+	return Point{
+		X: min(cx*g.Cell+g.Cell/2, g.sx-1),
+		Y: min(cy*g.Cell+g.Cell/2, g.sy-1),
+	}
+}
+
+var (
+	cached   *Grid
+	cachedMu sync.Mutex
+)
+
+// 使用默认网格寻路，地形变化后自动重建网格
+func Find(from, to Point) []Point {
+	return Default().Find(from, to)
+}
+
+// 默认网格
+func Default() *Grid {
+	cachedMu.Lock()
+	defer cachedMu.Unlock()
+	if cached == nil || cached.Version != model.MapVersion.Load() {
+		cached = NewGrid(DefaultCell, DefaultRadius)
+	}
+	return cached
+}
+
+type node struct {
+	idx int32
+	f   int32
+	h   int32
+}
+
+// f 相同时优先离终点近的，减少展开的节点
+func (a node) less(b node) bool {
+	if a.f != b.f {
+		return a.f < b.f
+	}
+	return a.h < b.h
+}
+
+// 二叉堆，避免 container/heap 每次 Push 的装箱分配
+type nodeHeap []node
+
+func (h *nodeHeap) push(n node) {
+	*h = append(*h, n)
+	s := *h
+	for i := len(s) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !s[i].less(s[p]) {
+			break
+		}
+		s[i], s[p] = s[p], s[i]
+		i = p
+	}
+}
+
+func (h *nodeHeap) pop() node {
+	s := *h
+	top := s[0]
+	last := len(s) - 1
+	s[0] = s[last]
+	s = s[:last]
+	for i := 0; ; {
+		l, r, m := 2*i+1, 2*i+2, i
+		if l < len(s) && s[l].less(s[m]) {
+			m = l
+		}
+		if r < len(s) && s[r].less(s[m]) {
+			m = r
+		}
+		if m == i {
+			break
+		}
+		s[i], s[m] = s[m], s[i]
+		i = m
+	}
+	*h = s
+	return top
+}
+
+// 每次查询的临时数组，复用以减少分配
+type scratch struct {
+	cost []int32
+	came []int32
+	open nodeHeap
+}
+
+var scratchPool sync.Pool
+
+func getScratch(n int) *scratch {
+	s, _ := scratchPool.Get().(*scratch)
+	if s == nil || len(s.cost) != n {
+		s = &scratch{cost: make([]int32, n), came: make([]int32, n)}
+	}
+	for i := range s.cost {
+		s.cost[i] = -1
+	}
+	s.open = s.open[:0]
+	return s
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
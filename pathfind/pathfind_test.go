@@ -0,0 +1,200 @@
+package pathfind
+
+import (
+	"testing"
+
+	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/model"
+)
+
+// 用字符画设置地形：'.' 空地，'~' 河流，'#' 树林；每行一个 y
+func setTerrain(tb testing.TB, rows ...string) {
+	tb.Helper()
+	model.ResizeMap(uint(len(rows[0])), uint(len(rows)))
+	for y, row := range rows {
+		for x, ch := range row {
+			switch ch {
+			case '~':
+				model.Map[y][x] = 2
+			case '#':
+				model.Map[y][x] = 3
+			}
+		}
+	}
+	model.MapVersion.Add(1)
+}
+
+// 按默认配置与固定种子生成一张完整尺寸的地图
+func generateMap(tb testing.TB) {
+	tb.Helper()
+	tb.Chdir(tb.TempDir()) // Maprandom 会在当前目录写 grid_points.png
+	s := model.DefaultSettings()
+	s.MapGen.Seed = 1
+	model.SetConf(s)
+	gamemap.Maprandom()
+}
+
+// 与 moveTank 相同：斜向移动时两侧都被挡住才不能通过
+func TestDiagonalCornerCutting(t *testing.T) {
+	tests := []struct {
+		name    string
+		terrain []string
+		want    bool
+	}{
+		{"open", []string{
+			"..",
+			"..",
+		}, true},
+		{"one side blocked", []string{
+			".~",
+			"..",
+		}, true},
+		{"other side blocked", []string{
+			"..",
+			"#.",
+		}, true},
+		{"both sides blocked", []string{
+			".~",
+			"#.",
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTerrain(t, tt.terrain...)
+			g := NewGrid(1, 0)
+			if got := g.canStep(0, 0, 1, 1); got != tt.want {
+				t.Errorf("canStep(0,0,+1,+1) = %v, want %v", got, tt.want)
+			}
+			path := g.Find(Point{0, 0}, Point{1, 1})
+			if tt.want && (len(path) != 1 || path[0] != (Point{1, 1})) {
+				t.Errorf("Find = %v, want a single diagonal step", path)
+			}
+			if !tt.want && path != nil {
+				t.Errorf("Find = %v, want nil", path)
+			}
+		})
+	}
+}
+
+// 目标在另一个连通区域时不展开搜索，直接返回 nil
+func TestFindUnreachable(t *testing.T) {
+	tests := []struct {
+		name     string
+		terrain  []string
+		from, to Point
+	}{
+		{"river wall", []string{
+			"...~...",
+			"...~...",
+			"...~...",
+		}, Point{0, 1}, Point{6, 1}},
+		{"diagonal gap", []string{
+			"..~....",
+			"..~....",
+			"...#...",
+			"...#...",
+		}, Point{0, 0}, Point{6, 3}},
+		{"enclosed target", []string{
+			".......",
+			"..###..",
+			"..#.#..",
+			"..###..",
+		}, Point{0, 0}, Point{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTerrain(t, tt.terrain...)
+			g := NewGrid(1, 0)
+			if path := g.Find(tt.from, tt.to); path != nil {
+				t.Errorf("Find = %v, want nil", path)
+			}
+			start, goal := tt.from.Y*g.w+tt.from.X, tt.to.Y*g.w+tt.to.X
+			if g.open[goal] && g.region[start] == g.region[goal] {
+				t.Errorf("start and goal share region %d, want different regions", g.region[start])
+			}
+		})
+	}
+}
+
+// model.MapVersion 变化后 Default 重建网格，否则复用
+func TestDefaultRebuildsOnMapVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		terrain []string
+		bump    bool
+		want    bool // 地形变化后 (0,0) 到 (8,0) 是否可达
+	}{
+		{"same version keeps grid", []string{
+			"....~....",
+		}, false, true},
+		{"new version rebuilds grid", []string{
+			"....~....",
+		}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTerrain(t, ".........")
+			before := Default()
+			if Find(Point{0, 0}, Point{8, 0}) == nil {
+				t.Fatal("open row is unreachable")
+			}
+
+			// 直接改地形；只有版本号变化时缓存才会失效
+			version := model.MapVersion.Load()
+			setTerrain(t, tt.terrain...)
+			if !tt.bump {
+				model.MapVersion.Store(version)
+			}
+
+			after := Default()
+			if rebuilt := after != before; rebuilt != tt.bump {
+				t.Errorf("rebuilt = %v, want %v", rebuilt, tt.bump)
+			}
+			if after.Version != model.MapVersion.Load() {
+				t.Errorf("grid version = %d, want %d", after.Version, model.MapVersion.Load())
+			}
+			if got := Find(Point{0, 0}, Point{8, 0}) != nil; got != tt.want {
+				t.Errorf("reachable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cold 每次都重建网格，warm 命中缓存
+func BenchmarkNewGrid(b *testing.B) {
+	generateMap(b)
+	b.Run("cold", func(b *testing.B) {
+		for b.Loop() {
+			model.MapVersion.Add(1)
+			Default()
+		}
+	})
+	b.Run("warm", func(b *testing.B) {
+		Default()
+		for b.Loop() {
+			Default()
+		}
+	})
+}
+
+// 从左上角到右下角的最长查询；cold 包含重建网格
+func BenchmarkFind(b *testing.B) {
+	generateMap(b)
+	from := Point{1, 1}
+	to := Point{int(model.MapSizeX) - 2, int(model.MapSizeY) - 2}
+	if Find(from, to) == nil {
+		b.Fatalf("no path from %v to %v", from, to)
+	}
+	b.Run("cold", func(b *testing.B) {
+		for b.Loop() {
+			model.MapVersion.Add(1)
+			Find(from, to)
+		}
+	})
+	b.Run("warm", func(b *testing.B) {
+		Default()
+		for b.Loop() {
+			Find(from, to)
+		}
+	})
+}
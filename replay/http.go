@@ -0,0 +1,18 @@
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GET /replays
+func ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := List()
+	if err != nil {
+		logger.Error("list error", "err", err)
+		http.Error(w, "replays unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
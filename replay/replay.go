@@ -0,0 +1,326 @@
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+)
+
+var logger = logging.New("replay")
+
+// 回放文件：gzip 压缩的 JSON Lines，第一行为 Header，之后每行一个 Frame。
+// 第一帧是观战用的 type=1 完整地形，其余帧是比赛期间广播给客户端的原始消息。
+
+const (
+	Version    = 1
+	fileSuffix = ".jsonl.gz"
+)
+
+var ErrNotFound = errors.New("replay not found")
+
+// 文件头
+type Header struct {
+	Version   int    `json:"version"`
+	Round     int    `json:"round"`
+	MapName   string `json:"map_name"`
+	StartedAt int64  `json:"started_at"` // unix 毫秒
+}
+
+// 一条广播消息
+type Frame struct {
+	T   int64           `json:"t"`   // 距录制开始的毫秒数
+	Msg json.RawMessage `json:"msg"` // 与发送给客户端的消息完全相同
+}
+
+// 回放列表项
+type Info struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Header
+}
+
+type recorder struct {
+	file   *os.File
+	gz     *gzip.Writer
+	start  time.Time
+	frames int
+}
+
+var (
+	current *recorder
+	mu      sync.Mutex
+)
+
+// 开始录制一局，config 为第一帧；配置中目录为空时不录制
+func Start(round int, mapName string, config []byte) error {
+	cfg := model.Conf().Replay
+	if cfg.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return fmt.Errorf("create replay dir %s: %w", cfg.Dir, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		closeRecorder(current)
+		current = nil
+	}
+
+	start := time.Now()
+	name := fmt.Sprintf("%s-round%d%s", start.Format("20060102-150405"), round, fileSuffix)
+	f, err := os.Create(filepath.Join(cfg.Dir, name))
+	if err != nil {
+		return fmt.Errorf("create replay %s: %w", name, err)
+	}
+	rec := &recorder{file: f, gz: gzip.NewWriter(f), start: start}
+
+	header, _ := json.Marshal(Header{
+		Version:   Version,
+		Round:     round,
+		MapName:   mapName,
+		StartedAt: start.UnixMilli(),
+	})
+	rec.gz.Write(append(header, '\n'))
+	rec.write(0, config)
+
+	current = rec
+	logger.Info("开始录制", "replay", name, "round", round)
+	go prune(cfg.Dir, cfg.MaxFiles)
+	return nil
+}
+
+// 记录一条广播消息，未在录制时忽略
+func Record(msg []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return
+	}
+	current.write(time.Since(current.start).Milliseconds(), msg)
+}
+
+// 结束录制并写盘
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return
+	}
+	closeRecorder(current)
+	current = nil
+}
+
+// 消息本身已是合法 JSON，直接拼接，避免再编码一次
+func (r *recorder) write(t int64, msg []byte) {
+	fmt.Fprintf(r.gz, `{"t":%d,"msg":%s}`+"\n", t, msg)
+	r.frames++
+}
+
+func closeRecorder(r *recorder) {
+	if err := r.gz.Close(); err != nil {
+		logger.Error("write error", "err", err)
+	}
+	if err := r.file.Close(); err != nil {
+		logger.Error("close error", "err", err)
+	}
+	logger.Info("录制结束", "replay", filepath.Base(r.file.Name()),
+		"frames", r.frames, "seconds", time.Since(r.start).Seconds())
+}
+
+// 逐帧读取回放文件，不把整个文件载入内存
+type Reader struct {
+	Header Header
+	name   string
+	f      *os.File
+	rd     *bufio.Reader
+	frames int
+}
+
+// 打开回放并读取文件头
+func Open(name string) (*Reader, error) {
+	path, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read replay %s: %w", name, err)
+	}
+	r := &Reader{name: name, f: f, rd: bufio.NewReader(gz)}
+	line, err := r.rd.ReadBytes('\n')
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read replay %s: %w", name, err)
+	}
+	if err := json.Unmarshal(line, &r.Header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read replay %s header: %w", name, err)
+	}
+	if r.Header.Version != Version {
+		f.Close()
+		return nil, fmt.Errorf("replay %s has unsupported version %d", name, r.Header.Version)
+	}
+	return r, nil
+}
+
+// 读取下一帧，读完时返回 io.EOF；文件因异常退出而被截断或某帧无法解析时，
+// 记录日志后同样返回 io.EOF，相当于回放在此结束
+func (r *Reader) Next() (Frame, error) {
+	var fr Frame
+	line, err := r.rd.ReadBytes('\n')
+	if err != nil {
+		if err != io.EOF {
+			logger.Warn("回放不完整，只读取部分帧", "replay", r.name, "frames", r.frames, "err", err)
+		}
+		return fr, io.EOF
+	}
+	if err := json.Unmarshal(line, &fr); err != nil {
+		logger.Warn("帧无法解析，停止读取", "replay", r.name, "frame", r.frames+1, "err", err)
+		return fr, io.EOF
+	}
+	r.frames++
+	return fr, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// 读一遍回放，返回文件头、时长（最后一帧的时间，毫秒）与帧数，不保留帧内容
+func Scan(name string) (*Header, int64, int, error) {
+	r, err := Open(name)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer r.Close()
+
+	var duration int64
+	for {
+		fr, err := r.Next()
+		if err != nil {
+			break
+		}
+		duration = fr.T
+	}
+	if r.frames == 0 {
+		return nil, 0, 0, fmt.Errorf("replay %s has no frames", name)
+	}
+	return &r.Header, duration, r.frames, nil
+}
+
+// 列出回放，最新的在前
+func List() ([]*Info, error) {
+	dir := model.Conf().Replay.Dir
+	names, err := replayFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Info, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		info, err := readInfo(filepath.Join(dir, names[i]))
+		if err != nil {
+			logger.Warn("skip replay", "replay", names[i], "err", err)
+			continue
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+func readInfo(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(gz).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Name: filepath.Base(path), Size: st.Size()}
+	if err := json.Unmarshal(line, &info.Header); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// 按文件名（即开始时间）排序的回放文件
+func replayFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), fileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 只接受目录下的文件名，防止路径穿越
+func resolve(name string) (string, error) {
+	dir := model.Conf().Replay.Dir
+	if dir == "" || name == "" || filepath.Base(name) != name || !strings.HasSuffix(name, fileSuffix) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// 删除超出数量上限的旧回放（正在录制的是最新的一个，不会被删除）
+func prune(dir string, max int) {
+	if max <= 0 {
+		return
+	}
+	names, err := replayFiles(dir)
+	if err != nil {
+		logger.Error("prune error", "err", err)
+		return
+	}
+	for len(names) > max {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			logger.Error("prune error", "err", err)
+		}
+		names = names[1:]
+	}
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// 排行榜
+type Leaderboard struct {
+	Period  string         `json:"period"`
+	Sort    string         `json:"sort"`
+	Players []*PlayerStats `json:"players"`
+}
+
+// 排序字段
+var sortKeys = map[string]func(*PlayerStats) int64{
+	"kills":        func(s *PlayerStats) int64 { return int64(s.Kills) },
+	"deaths":       func(s *PlayerStats) int64 { return int64(s.Deaths) },
+	"shots":        func(s *PlayerStats) int64 { return int64(s.Shots) },
+	"hits":         func(s *PlayerStats) int64 { return int64(s.Hits) },
+	"play_seconds": func(s *PlayerStats) int64 { return s.PlaySeconds },
+}
+
+// GET /leaderboard?period=all|week&sort=kills&limit=20
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	period := q.Get("period")
+	if period == "" {
+		period = PeriodAll
+	}
+	if period != PeriodAll && period != PeriodWeek {
+		http.Error(w, "period must be all or week", http.StatusBadRequest)
+		return
+	}
+
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = "kills"
+	}
+	key, ok := sortKeys[sortBy]
+	if !ok {
+		http.Error(w, "unknown sort field "+sortBy, http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	list, err := load(period)
+	if err != nil {
+		logger.Error("leaderboard error", "err", err)
+		http.Error(w, "stats unavailable", http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := key(list[i]), key(list[j])
+		if a != b {
+			return a > b
+		}
+		return list[i].Username < list[j].Username
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	if list == nil {
+		list = []*PlayerStats{}
+	}
+
+	writeJSON(w, Leaderboard{Period: period, Sort: sortBy, Players: list})
+}
+
+// GET /players/{name}/stats
+func PlayerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	all, err := Get(name, PeriodAll)
+	if err != nil {
+		logger.Error("player stats error", "player", name, "err", err)
+		http.Error(w, "stats unavailable", http.StatusInternalServerError)
+		return
+	}
+	week, err := Get(name, PeriodWeek)
+	if err != nil {
+		logger.Error("player stats error", "player", name, "err", err)
+		http.Error(w, "stats unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]*PlayerStats{
+		PeriodAll:  all,
+		PeriodWeek: week,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,305 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+var logger = logging.New("stats")
+
+const (
+	PeriodAll  = "all"
+	PeriodWeek = "week"
+)
+
+// 玩家统计，以规范化后的用户名（model.NormalizeUsername）为键，
+// 大小写或全角半角不同的名字计入同一份统计
+type PlayerStats struct {
+	Username    string `json:"username"` // 最近一次记录时的原始写法
+	Kills       int    `json:"kills"`
+	Deaths      int    `json:"deaths"`
+	Shots       int    `json:"shots"`
+	Hits        int    `json:"hits"`
+	PlaySeconds int64  `json:"play_seconds"`
+}
+
+// 累加另一份统计
+func (s *PlayerStats) add(d *PlayerStats) {
+	s.Kills += d.Kills
+	s.Deaths += d.Deaths
+	s.Shots += d.Shots
+	s.Hits += d.Hits
+	s.PlaySeconds += d.PlaySeconds
+}
+
+var (
+	db        *bolt.DB
+	pending   = make(map[string]*PlayerStats) // 规范化用户名 -> 尚未写盘的增量
+	pendingMu sync.Mutex
+)
+
+// 打开统计数据库，path 为空时不记录统计
+func Open(path string) error {
+	if path == "" {
+		return nil
+	}
+	d, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("open stats db %s: %w", path, err)
+	}
+	if err := d.Update(migrateKeys); err != nil {
+		d.Close()
+		return fmt.Errorf("migrate stats db %s: %w", path, err)
+	}
+	db = d
+	logger.Info("统计数据库已打开", "path", path)
+	return nil
+}
+
+// 旧版本以原始用户名为键，改为规范化后的键；规范化后相同的几份统计合并为一份
+func migrateKeys(tx *bolt.Tx) error {
+	moved := 0
+	err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			if string(k) != model.NormalizeUsername(string(k)) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			var old PlayerStats
+			if err := json.Unmarshal(b.Get(k), &old); err != nil {
+				return fmt.Errorf("%s %q: %w", name, k, err)
+			}
+			key := []byte(model.NormalizeUsername(string(k)))
+			s := &PlayerStats{Username: old.Username}
+			if raw := b.Get(key); raw != nil {
+				if err := json.Unmarshal(raw, s); err != nil {
+					return fmt.Errorf("%s %q: %w", name, key, err)
+				}
+			}
+			s.add(&old)
+			raw, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, raw); err != nil {
+				return err
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			moved++
+		}
+		return nil
+	})
+	if moved > 0 {
+		logger.Info("统计键已规范化", "count", moved)
+	}
+	return err
+}
+
+// 写盘并关闭数据库
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	if err := Flush(); err != nil {
+		logger.Error("flush error", "err", err)
+	}
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// 定时写盘，ctx 取消时退出，最后一次写盘由 Close 完成
+func FlushLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := Flush(); err != nil {
+			logger.Error("flush error", "err", err)
+		}
+	}
+}
+
+// 记录开火
+func RecordShot(username string) {
+	record(username, func(s *PlayerStats) { s.Shots++ })
+}
+
+// 记录命中，kill 表示命中时目标仍存活
+func RecordHit(shooter string, kill bool) {
+	record(shooter, func(s *PlayerStats) {
+		s.Hits++
+		if kill {
+			s.Kills++
+		}
+	})
+}
+
+// 记录死亡
+func RecordDeath(username string) {
+	record(username, func(s *PlayerStats) { s.Deaths++ })
+}
+
+// 记录在线时长
+func RecordPlayTime(username string, d time.Duration) {
+	record(username, func(s *PlayerStats) { s.PlaySeconds += int64(d / time.Second) })
+}
+
+func record(username string, apply func(*PlayerStats)) {
+	if db == nil || username == "" {
+		return
+	}
+	key := model.NormalizeUsername(username)
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	s, ok := pending[key]
+	if !ok {
+		s = &PlayerStats{}
+		pending[key] = s
+	}
+	s.Username = username
+	apply(s)
+}
+
+// 将内存中的增量写入总榜与周榜
+func Flush() error {
+	if db == nil {
+		return nil
+	}
+	pendingMu.Lock()
+	batch := pending
+	pending = make(map[string]*PlayerStats)
+	pendingMu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	buckets := []string{bucketName(PeriodAll, time.Now()), bucketName(PeriodWeek, time.Now())}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			b, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			for key, delta := range batch {
+				s := &PlayerStats{}
+				if raw := b.Get([]byte(key)); raw != nil {
+					if err := json.Unmarshal(raw, s); err != nil {
+						return err
+					}
+				}
+				s.add(delta)
+				s.Username = delta.Username
+				raw, err := json.Marshal(s)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte(key), raw); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// 事务整体回滚，放回待写入的增量，下次写盘时重试
+		requeue(batch)
+		return fmt.Errorf("flush %d players: %w", len(batch), err)
+	}
+	return nil
+}
+
+// 把写盘失败的增量合并回 pending
+func requeue(batch map[string]*PlayerStats) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	for key, delta := range batch {
+		if s, ok := pending[key]; ok {
+			// pending 中是更新的写法
+			s.add(delta)
+		} else {
+			pending[key] = delta
+		}
+	}
+}
+
+// 读取某一周期的全部统计
+func load(period string) ([]*PlayerStats, error) {
+	if db == nil {
+		return nil, nil
+	}
+	if err := Flush(); err != nil {
+		return nil, err
+	}
+	var list []*PlayerStats
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName(period, time.Now())))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s PlayerStats
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			list = append(list, &s)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// 读取单个玩家的统计，不存在时返回零值
+func Get(username, period string) (*PlayerStats, error) {
+	s := &PlayerStats{Username: username}
+	if db == nil {
+		return s, nil
+	}
+	if err := Flush(); err != nil {
+		return nil, err
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName(period, time.Now())))
+		if b == nil {
+			return nil
+		}
+		if raw := b.Get([]byte(model.NormalizeUsername(username))); raw != nil {
+			return json.Unmarshal(raw, s)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// 周榜按 ISO 周分桶
+func bucketName(period string, now time.Time) string {
+	if period == PeriodWeek {
+		year, week := now.ISOWeek()
+		return fmt.Sprintf("week-%d-W%02d", year, week)
+	}
+	return "all"
+}
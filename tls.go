@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS 配置，启用后 websocket_path 与 map_websocket_path 改用 wss://
+type TLSConfig struct {
+	CertFile     string   `json:"cert_file"`     // PEM 证书，可包含中间证书链
+	KeyFile      string   `json:"key_file"`      // PEM 私钥
+	SelfSigned   bool     `json:"self_signed"`   // 启动时生成自签名证书，仅用于开发，不能与 cert_file 同时使用
+	Hosts        []string `json:"hosts"`         // 自签名证书包含的域名或 IP
+	RedirectPort int      `json:"redirect_port"` // 非 0 时在此端口监听明文 HTTP 并重定向到 https，0 表示不监听
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.SelfSigned
+}
+
+func (c TLSConfig) validate(serverPort int) []error {
+	var errs []error
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("tls.cert_file and tls.key_file must be set together"))
+	}
+	if c.SelfSigned && c.CertFile != "" {
+		errs = append(errs, errors.New("tls.self_signed cannot be used with tls.cert_file"))
+	}
+	if c.SelfSigned && len(c.Hosts) == 0 {
+		errs = append(errs, errors.New("tls.hosts must not be empty when tls.self_signed is set"))
+	}
+	if c.RedirectPort != 0 {
+		if !c.Enabled() {
+			errs = append(errs, errors.New("tls.redirect_port requires tls.cert_file or tls.self_signed"))
+		}
+		if c.RedirectPort < 1 || c.RedirectPort > 65535 {
+			errs = append(errs, fmt.Errorf("tls.redirect_port must be between 1 and 65535, got %d", c.RedirectPort))
+		}
+		if c.RedirectPort == serverPort {
+			errs = append(errs, fmt.Errorf("tls.redirect_port must differ from server_port, both are %d", serverPort))
+		}
+	}
+	return errs
+}
+
+// 载入证书，未启用 TLS 时返回 nil
+func loadTLS(c TLSConfig) (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	var cert tls.Certificate
+	var err error
+	if c.SelfSigned {
+		cert, err = selfSignedCert(c.Hosts)
+	} else {
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(leaf.Raw)
+	slog.Info("TLS 证书已载入", "self_signed", c.SelfSigned, "subject", leaf.Subject.CommonName,
+		"dns", leaf.DNSNames, "ip", leaf.IPAddresses, "not_after", leaf.NotAfter,
+		"sha256", hex.EncodeToString(sum[:]))
+	if time.Until(leaf.NotAfter) < 30*24*time.Hour {
+		slog.Warn("TLS 证书即将过期", "not_after", leaf.NotAfter)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// 生成一年有效期的 ECDSA 自签名证书，只保存在内存中，每次启动都会变化
+func selfSignedCert(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"lite_demo development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// 明文端口：把请求以 308 重定向到 https，保留路径与查询参数
+func redirectServer(redirectPort, tlsPort int) *http.Server {
+	return &http.Server{
+		Addr: fmt.Sprintf("0.0.0.0:%d", redirectPort),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				// 请求中没有端口
+				host = strings.Trim(r.Host, "[]")
+			}
+			if tlsPort != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(tlsPort))
+			} else if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
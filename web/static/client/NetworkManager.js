@@ -7,19 +7,21 @@ class NetworkManager {
         this.ws = null;
         this.isConnected = false;
         this.serverUrl = ''; // 初始化为空
-        this.loadConfig(); // 加载配置
+        this.configReady = this.loadConfig(); // 加载配置，connect 时等待完成
     }
 
-    // 新增配置加载方法
+    // 从 /config 取得连接路径，页面由游戏服务端提供，连接同一地址
     async loadConfig() {
         try {
             const response = await fetch('/config');
             const config = await response.json();
-            this.serverUrl = `ws://${window.location.hostname}:${config.server_port}${config.websocket_path}`;
+            const scheme = config.tls ? 'wss' : 'ws';
+            this.serverUrl = `${scheme}://${window.location.host}${config.websocket_path}`;
         } catch (error) {
             console.error('加载配置失败:', error);
-            // 使用默认配置
-            this.serverUrl = 'ws://192.168.10.94:8888/ws';
+            // 连接本页所在服务器的默认路径
+            const scheme = window.location.protocol === 'https:' ? 'wss' : 'ws';
+            this.serverUrl = `${scheme}://${window.location.host}/ws`;
         }
     }
 
@@ -28,7 +30,8 @@ class NetworkManager {
      * @param {string} username 用户名
      * @returns {Promise} 连接Promise
      */
-    connect(username) {
+    async connect(username) {
+        await this.configReady;
         return new Promise((resolve, reject) => {
             try {
                 this.ws = new WebSocket(this.serverUrl);
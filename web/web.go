@@ -0,0 +1,34 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// 浏览器客户端：index.html 为游戏页面，view.html 为观战页面，test.html 为多连接调试页面，
+// 页面通过 /config 取得 websocket 路径
+//
+//go:embed static
+var static embed.FS
+
+// 挂在 "/" 上，其他已注册的路径优先
+var Handler http.Handler = newHandler()
+
+func newHandler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServerFS(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// 内嵌文件没有修改时间，禁止缓存，避免升级后仍使用旧脚本
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,615 @@
+package webserver
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/logging"
+	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/model"
+)
+
+const (
+	adminMaxBody       = 64 << 10
+	adminMaxNoticeLen  = 500
+	adminDefaultReason = "kicked by admin"
+)
+
+var (
+	adminLog = logging.New("admin")
+	auditMu  sync.Mutex
+)
+
+// 注册管理接口，所有请求需携带 Authorization: Bearer <admin.token>
+func RegisterAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/clients", adminHandler("clients", adminClients))
+	mux.HandleFunc("POST /admin/kick", adminHandler("kick", adminKick))
+	mux.HandleFunc("GET /admin/bans", adminHandler("bans", adminBans))
+	mux.HandleFunc("POST /admin/ban", adminHandler("ban", adminBan))
+	mux.HandleFunc("POST /admin/unban", adminHandler("unban", adminUnban))
+	mux.HandleFunc("POST /admin/mute", adminHandler("mute", adminMute))
+	mux.HandleFunc("POST /admin/unmute", adminHandler("unmute", adminUnmute))
+	mux.HandleFunc("POST /admin/notice", adminHandler("notice", adminNotice))
+	mux.HandleFunc("POST /admin/map", adminHandler("map", adminMap))
+	mux.HandleFunc("POST /admin/scores/reset", adminHandler("reset_scores", adminResetScores))
+	mux.HandleFunc("POST /admin/tick", adminHandler("tick", adminTick))
+	mux.HandleFunc("POST /admin/reload", adminHandler("reload", adminReload))
+	mux.HandleFunc("POST /admin/config", adminHandler("config", adminConfig))
+}
+
+// 管理接口返回的错误，带 HTTP 状态码
+type adminError struct {
+	status int
+	msg    string
+}
+
+func (e *adminError) Error() string { return e.msg }
+
+func badRequest(format string, args ...any) error {
+	return &adminError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &adminError{http.StatusNotFound, fmt.Sprintf(format, args...)}
+}
+
+type adminFunc func(body []byte) (any, error)
+
+// 审计日志的一行
+type auditEntry struct {
+	Time   string          `json:"time"`
+	Remote string          `json:"remote"`
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Status int             `json:"status"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// 校验令牌、读取请求体、执行操作并写审计日志
+func adminHandler(action string, fn adminFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := auditEntry{
+			Time:   time.Now().UTC().Format(time.RFC3339Nano),
+			Remote: r.RemoteAddr,
+			Action: action,
+		}
+
+		token := model.Conf().Admin.Token
+		if token == "" {
+			http.Error(w, "admin api is disabled", http.StatusNotFound)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			entry.Status = http.StatusUnauthorized
+			entry.Error = "invalid admin token"
+			writeAudit(entry)
+			http.Error(w, entry.Error, entry.Status)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, adminMaxBody))
+		if err != nil {
+			http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Params = redactParams(body)
+
+		result, err := fn(body)
+		entry.Status = http.StatusOK
+		if err != nil {
+			entry.Status = http.StatusInternalServerError
+			var ae *adminError
+			if errors.As(err, &ae) {
+				entry.Status = ae.status
+			}
+			entry.Error = err.Error()
+		}
+		writeAudit(entry)
+
+		if err != nil {
+			http.Error(w, entry.Error, entry.Status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// 审计日志中隐藏的字段，任意层级的同名字段都会被替换，例如 /admin/config 中的 admin.token 与 auth.secret
+var secretParams = map[string]bool{
+	"token":    true,
+	"secret":   true,
+	"password": true,
+}
+
+// 复制请求参数并隐藏密钥；请求体不是合法 JSON 时不记录
+func redactParams(body []byte) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+	redact(v)
+	out, err := marshalNoEscape(v)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// 与 json.Marshal 相同，但不把 < > & 转义为 \u003c 等，保持审计日志可读
+func marshalNoEscape(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func redact(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if secretParams[strings.ToLower(k)] {
+				if s, ok := val.(string); !ok || s != "" {
+					v[k] = "<redacted>"
+				}
+				continue
+			}
+			redact(val)
+		}
+	case []any:
+		for _, item := range v {
+			redact(item)
+		}
+	}
+}
+
+// 追加一行审计日志，同时写入普通日志
+func writeAudit(e auditEntry) {
+	adminLog.Info("admin request", "action", e.Action, "remote", e.Remote,
+		"status", e.Status, "params", string(e.Params), "err", e.Error)
+
+	path := model.Conf().Admin.AuditLog
+	if path == "" {
+		return
+	}
+	line, err := marshalNoEscape(e)
+	if err != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		adminLog.Error("无法打开审计日志", "path", path, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		adminLog.Error("写入审计日志失败", "path", path, "err", err)
+	}
+}
+
+// 解析请求体，空请求体保持零值
+func decodeBody(body []byte, v any) error {
+	if len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return badRequest("invalid json: %v", err)
+	}
+	return nil
+}
+
+// 在线客户端信息
+type adminClient struct {
+	Username   string  `json:"username"`
+	IP         string  `json:"ip,omitempty"`
+	RTTMS      float64 `json:"rtt_ms"`
+	Point      int     `json:"point"`
+	X          uint    `json:"x"`
+	Y          uint    `json:"y"`
+	Team       string  `json:"team,omitempty"`
+	Bot        bool    `json:"bot,omitempty"`
+	AFK        bool    `json:"afk,omitempty"`
+	Suspended  bool    `json:"suspended,omitempty"`  // 断线等待重连
+	Spectating bool    `json:"spectating,omitempty"` // 挂机后转为观战
+	Muted      bool    `json:"muted,omitempty"`      // 被禁止聊天
+	JoinedAt   int64   `json:"joined_at"`            // unix 毫秒
+	Dropped    int64   `json:"dropped"`              // 因限速丢弃的消息数
+}
+
+type adminSpectator struct {
+	ID       string `json:"id"`
+	IP       string `json:"ip"`
+	Mode     string `json:"mode"`
+	Target   string `json:"target,omitempty"`
+	JoinedAt int64  `json:"joined_at"`
+}
+
+// GET /admin/clients
+func adminClients([]byte) (any, error) {
+	model.ClientsMu.Lock()
+	clients := make([]adminClient, 0, len(model.Clients))
+	for _, c := range model.Clients {
+		ac := adminClient{
+			Username:   c.ID,
+			IP:         remoteIP(c.RemoteAddr),
+			RTTMS:      float64(c.RTT.Microseconds()) / 1000,
+			Team:       c.Team,
+			Bot:        c.Bot,
+			Suspended:  c.Suspended,
+			Spectating: c.Tank == nil,
+			JoinedAt:   c.JoinedAt.UnixMilli(),
+			Dropped:    c.Dropped,
+		}
+		_, ac.Muted = mutedUntil(c.ID)
+		if c.Tank != nil {
+			ac.Point = c.Tank.Point
+			ac.X, ac.Y = c.Tank.LocalX, c.Tank.LocalY
+			ac.AFK = c.Tank.AFK
+		}
+		clients = append(clients, ac)
+	}
+	model.ClientsMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Username < clients[j].Username })
+
+	model.SpectatorsMu.Lock()
+	specs := make([]adminSpectator, 0, len(model.Spectators))
+	for _, s := range model.Spectators {
+		as := adminSpectator{ID: s.ID, IP: remoteIP(s.RemoteAddr), JoinedAt: s.JoinedAt.UnixMilli()}
+		if s.Camera != nil {
+			as.Mode, as.Target = s.Camera.Mode, s.Camera.Target
+		}
+		specs = append(specs, as)
+	}
+	model.SpectatorsMu.Unlock()
+	sort.Slice(specs, func(i, j int) bool { return specs[i].ID < specs[j].ID })
+
+	return map[string]any{"clients": clients, "spectators": specs}, nil
+}
+
+type kickRequest struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+// POST /admin/kick {"username":"...","reason":"..."}
+func adminKick(body []byte) (any, error) {
+	var req kickRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Username == "" {
+		return nil, badRequest("username is required")
+	}
+	if req.Reason == "" {
+		req.Reason = adminDefaultReason
+	}
+	model.ClientsMu.Lock()
+	c := model.Clients[req.Username]
+	model.ClientsMu.Unlock()
+	if c == nil {
+		return nil, notFound("player %s is not online", req.Username)
+	}
+	kickPlayer(c, req.Reason)
+	return map[string]any{"kicked": c.ID}, nil
+}
+
+// 踢出玩家：在线玩家断开连接，挂起的会话直接释放，机器人交给 BotLoop 移除
+func kickPlayer(c *model.Client, reason string) {
+	model.ClientsMu.Lock()
+	if c.Bot {
+		c.Kicked = true
+		model.ClientsMu.Unlock()
+		return
+	}
+	suspended := c.Suspended
+	if suspended {
+		c.Suspended = false
+		if c.GraceTimer != nil {
+			c.GraceTimer.Stop()
+		}
+	}
+	model.ClientsMu.Unlock()
+
+	if suspended {
+		c.Kicked = true
+		releaseClient(c)
+		logging.Network.Warn("kicked", "event", "kick", "player", c.ID, "reason", reason)
+		return
+	}
+	kickClient(c, reason)
+}
+
+// GET /admin/bans
+func adminBans([]byte) (any, error) {
+	return map[string]any{"bans": listBans()}, nil
+}
+
+type banRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+	BanIP    bool   `json:"ban_ip"`  // 同时封禁该玩家当前的 IP
+	Minutes  int    `json:"minutes"` // 0 表示永久
+	Reason   string `json:"reason"`
+}
+
+// POST /admin/ban {"username":"...","ip":"...","ban_ip":true,"minutes":60,"reason":"..."}
+func adminBan(body []byte) (any, error) {
+	var req banRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Username == "" && req.IP == "" {
+		return nil, badRequest("username or ip is required")
+	}
+	if req.Minutes < 0 {
+		return nil, badRequest("minutes must not be negative")
+	}
+
+	if req.BanIP && req.IP == "" {
+		model.ClientsMu.Lock()
+		if c := model.Clients[req.Username]; c != nil && !c.Bot {
+			req.IP = remoteIP(c.RemoteAddr)
+		}
+		model.ClientsMu.Unlock()
+		if req.IP == "" {
+			return nil, notFound("player %s is not online, cannot ban ip", req.Username)
+		}
+	}
+
+	now := time.Now()
+	ban := &Ban{
+		Username:  req.Username,
+		IP:        req.IP,
+		Reason:    req.Reason,
+		CreatedAt: now.UnixMilli(),
+	}
+	if req.Minutes > 0 {
+		ban.ExpiresAt = now.Add(time.Duration(req.Minutes) * time.Minute).UnixMilli()
+	}
+	if err := addBan(ban); err != nil {
+		return nil, fmt.Errorf("save bans: %w", err)
+	}
+
+	// 踢出匹配的在线玩家
+	var matched []*model.Client
+	model.ClientsMu.Lock()
+	for _, c := range model.Clients {
+		if ban.matches(c.ID, remoteIP(c.RemoteAddr)) {
+			matched = append(matched, c)
+		}
+	}
+	model.ClientsMu.Unlock()
+	kicked := make([]string, 0, len(matched))
+	for _, c := range matched {
+		kickPlayer(c, ban.notice())
+		kicked = append(kicked, c.ID)
+	}
+	return map[string]any{"ban": ban, "kicked": kicked}, nil
+}
+
+type unbanRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+// POST /admin/unban {"username":"..."} 或 {"ip":"..."}
+func adminUnban(body []byte) (any, error) {
+	var req unbanRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Username == "" && req.IP == "" {
+		return nil, badRequest("username or ip is required")
+	}
+	n, err := removeBans(req.Username, req.IP)
+	if err != nil {
+		return nil, fmt.Errorf("save bans: %w", err)
+	}
+	if n == 0 {
+		return nil, notFound("no matching ban")
+	}
+	return map[string]any{"removed": n}, nil
+}
+
+type muteRequest struct {
+	Username string `json:"username"`
+	Minutes  int    `json:"minutes"` // 0 表示直到解除
+}
+
+// POST /admin/mute {"username":"...","minutes":10}，玩家不在线也可以提前禁言
+func adminMute(body []byte) (any, error) {
+	var req muteRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Username == "" {
+		return nil, badRequest("username is required")
+	}
+	if req.Minutes < 0 {
+		return nil, badRequest("minutes must not be negative")
+	}
+	until := mutePlayer(req.Username, req.Minutes)
+
+	// 告知匹配的在线玩家，用户名比较与禁言检查一致
+	key := model.NormalizeUsername(req.Username)
+	var matched []*model.Client
+	model.ClientsMu.Lock()
+	for _, c := range model.Clients {
+		if !c.Bot && !c.Suspended && model.NormalizeUsername(c.ID) == key {
+			matched = append(matched, c)
+		}
+	}
+	model.ClientsMu.Unlock()
+	for _, c := range matched {
+		sendNotice(c, muteNotice(until))
+	}
+	return map[string]any{"username": req.Username, "expires_at": until}, nil
+}
+
+type unmuteRequest struct {
+	Username string `json:"username"`
+}
+
+// POST /admin/unmute {"username":"..."}
+func adminUnmute(body []byte) (any, error) {
+	var req unmuteRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Username == "" {
+		return nil, badRequest("username is required")
+	}
+	if !unmutePlayer(req.Username) {
+		return nil, notFound("player %s is not muted", req.Username)
+	}
+	return map[string]any{"username": req.Username}, nil
+}
+
+type noticeRequest struct {
+	Notice string `json:"notice"`
+}
+
+// POST /admin/notice {"notice":"..."}，以 type=0 发给所有玩家与观战者
+func adminNotice(body []byte) (any, error) {
+	var req noticeRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	req.Notice = strings.TrimSpace(req.Notice)
+	if req.Notice == "" {
+		return nil, badRequest("notice is required")
+	}
+	if len([]rune(req.Notice)) > adminMaxNoticeLen {
+		return nil, badRequest("notice must be at most %d characters", adminMaxNoticeLen)
+	}
+	data, err := RePackWebMessageJson(0, model.NoticePayload{Notice: req.Notice}, "admin")
+	if err != nil {
+		return nil, err
+	}
+	broadcastToAllClients(data, "Broadcast notice")
+	return map[string]any{"notice": req.Notice}, nil
+}
+
+type mapRequest struct {
+	Action string `json:"action"` // regenerate 或 load
+	File   string `json:"file"`   // load 时的地图文件
+}
+
+// POST /admin/map {"action":"regenerate"} 或 {"action":"load","file":"maps/arena.png"}
+// 换图后所有玩家重新分配出生点并收到新的 type=1，分数保留
+func adminMap(body []byte) (any, error) {
+	var req mapRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	var load func() (string, error)
+	switch req.Action {
+	case "regenerate":
+		load = func() (string, error) {
+			gamemap.Maprandom()
+			return "random", nil
+		}
+	case "load":
+		if req.File == "" {
+			return nil, badRequest("file is required")
+		}
+		load = func() (string, error) {
+			if err := gamemap.LoadMapFile(req.File); err != nil {
+				return "", badRequest("load map: %v", err)
+			}
+			return filepath.Base(req.File), nil
+		}
+	default:
+		return nil, badRequest("action must be regenerate or load")
+	}
+
+	name, players, err := changeMap(load, true)
+	if err != nil {
+		return nil, err
+	}
+	logging.Map.Info("管理员换图", "event", "map_change", "map", name, "players", players)
+	return map[string]any{"map_name": name, "players": players}, nil
+}
+
+// POST /admin/scores/reset
+func adminResetScores([]byte) (any, error) {
+	resetScores()
+	logging.Game.Info("管理员清零分数", "event", "reset_scores")
+	return map[string]any{"reset": true}, nil
+}
+
+type tickRequest struct {
+	TickIntervalMS int64 `json:"tick_interval_ms"`
+}
+
+// POST /admin/tick {"tick_interval_ms":100}，修改 type=2 的广播间隔
+func adminTick(body []byte) (any, error) {
+	var req tickRequest
+	if err := decodeBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.TickIntervalMS < model.MinTickIntervalMS || req.TickIntervalMS > model.MaxTickIntervalMS {
+		return nil, badRequest("tick_interval_ms must be between %d and %d", model.MinTickIntervalMS, model.MaxTickIntervalMS)
+	}
+	old := model.TickIntervalMS.Swap(req.TickIntervalMS)
+	logging.Game.Info("广播间隔已修改", "event", "tick", "from_ms", old, "to_ms", req.TickIntervalMS)
+	if old != req.TickIntervalMS {
+		broadcastSettings()
+	}
+	return map[string]any{"tick_interval_ms": req.TickIntervalMS, "previous_ms": old}, nil
+}
+
+// POST /admin/reload，重新读取配置文件
+func adminReload([]byte) (any, error) {
+	if ReloadConfigFile == nil {
+		return nil, notFound("config reload is unavailable")
+	}
+	report, err := ReloadConfigFile()
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return report, nil
+}
+
+// POST /admin/config {"game":{"reload_seconds":2}}，在当前配置上修改部分字段，不写回配置文件
+func adminConfig(body []byte) (any, error) {
+	if len(body) == 0 {
+		return nil, badRequest("request body is required")
+	}
+	// 经 JSON 深拷贝，避免修改当前配置中共用的 map 与切片
+	current, err := json.Marshal(model.Conf())
+	if err != nil {
+		return nil, err
+	}
+	var next model.Settings
+	if err := json.Unmarshal(current, &next); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		return nil, badRequest("invalid json: %v", err)
+	}
+	report, err := ApplySettings(next, "admin")
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,181 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+)
+
+// 封禁记录，Username 与 IP 至少有一个
+type Ban struct {
+	Username  string `json:"username,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`           // unix 毫秒
+	ExpiresAt int64  `json:"expires_at,omitempty"` // unix 毫秒，0 表示永久
+}
+
+var (
+	bans     []*Ban
+	bansMu   sync.Mutex
+	bansFile string
+)
+
+// 载入封禁列表，文件不存在时从空列表开始
+func LoadBans(path string) error {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	bansFile = path
+	bans = nil
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	logging.Network.Info("封禁列表已载入", "path", path, "bans", len(bans))
+	return nil
+}
+
+// 写入封禁列表，调用方持有 bansMu
+func saveBans() error {
+	if bansFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := bansFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, bansFile)
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != 0 && now.UnixMilli() >= b.ExpiresAt
+}
+
+func (b *Ban) matches(username, ip string) bool {
+	if b.Username != "" && username != "" && model.NormalizeUsername(b.Username) == model.NormalizeUsername(username) {
+		return true
+	}
+	return b.IP != "" && ip != "" && b.IP == ip
+}
+
+// 发给被封禁客户端的说明
+func (b *Ban) notice() string {
+	msg := "you are banned"
+	if b.Reason != "" {
+		msg += ": " + b.Reason
+	}
+	if b.ExpiresAt != 0 {
+		msg += " (until " + time.UnixMilli(b.ExpiresAt).UTC().Format(time.RFC3339) + ")"
+	}
+	return msg
+}
+
+// 按用户名或 IP 查找有效的封禁，顺便清理已过期的记录
+func findBan(username, ip string) *Ban {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	now := time.Now()
+	var found *Ban
+	kept := bans[:0]
+	for _, b := range bans {
+		if b.expired(now) {
+			continue
+		}
+		kept = append(kept, b)
+		if found == nil && b.matches(username, ip) {
+			found = b
+		}
+	}
+	if len(kept) != len(bans) {
+		clear(bans[len(kept):])
+		bans = kept
+		if err := saveBans(); err != nil {
+			logging.Network.Error("保存封禁列表失败", "err", err)
+		}
+	}
+	return found
+}
+
+func addBan(b *Ban) error {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	bans = append(bans, b)
+	return saveBans()
+}
+
+// 解除匹配用户名或 IP 的封禁，返回解除的数量
+func removeBans(username, ip string) (int, error) {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	kept := bans[:0]
+	for _, b := range bans {
+		if (username != "" && b.Username != "" && model.NormalizeUsername(b.Username) == model.NormalizeUsername(username)) ||
+			(ip != "" && b.IP == ip) {
+			continue
+		}
+		kept = append(kept, b)
+	}
+	removed := len(bans) - len(kept)
+	clear(bans[len(kept):])
+	bans = kept
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, saveBans()
+}
+
+// 当前有效的封禁
+func listBans() []*Ban {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	now := time.Now()
+	list := make([]*Ban, 0, len(bans))
+	for _, b := range bans {
+		if !b.expired(now) {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+// 从 ip:port 中取出 ip
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// 被封禁的 IP 在升级为 websocket 之前直接拒绝
+func rejectBannedIP(w http.ResponseWriter, r *http.Request) bool {
+	ip := remoteIP(r.RemoteAddr)
+	ban := findBan("", ip)
+	if ban == nil {
+		return false
+	}
+	logging.Network.Info("rejected banned ip", "remote", r.RemoteAddr, "reason", ban.Reason)
+	http.Error(w, ban.notice(), http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,442 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/pathfind"
+)
+
+const (
+	botBulletSpeed  = 120.0 // 与客户端子弹速度一致（格/秒）
+	botBulletStep   = 0.5   // 碰撞检测步长（格）
+	botHitRadius    = 0.6   // 子弹半径 + 坦克半径
+	botStuckTicks   = 20    // 连续多少个 tick 没有移动视为卡住
+	botWanderTicks  = 20    // 卡住后随机游走的 tick 数
+	botBalanceEvery = time.Second
+	botReplanEvery  = time.Second // 追击路径重算间隔，另加随机抖动错开各机器人
+)
+
+// 机器人的决策状态，只在 BotLoop 中访问
+type botBrain struct {
+	client   *model.Client
+	dir      byte // 最近一次发出的移动方向
+	lastX    uint
+	lastY    uint
+	stuck    int
+	wander   int
+	wanderTo byte
+	diedAt   time.Time
+	path     []pathfind.Point
+	replanAt time.Time
+}
+
+// 机器人发射的子弹，由服务端模拟（真人子弹由客户端检测命中）
+type botBullet struct {
+	owner  string
+	x, y   float64
+	vx, vy float64
+}
+
+var (
+	bots       = make(map[string]*botBrain)
+	botBullets []*botBullet
+)
+
+// 按顺时针排列的八个方向，用于绕开障碍
+var botDirs = []byte{
+	model.DirUp, model.DirUpRight, model.DirRight, model.DirDownRight,
+	model.DirDown, model.DirDownLeft, model.DirLeft, model.DirUpLeft,
+}
+
+// 机器人循环：补足人数、决策、模拟子弹
+func BotLoop(ctx context.Context) {
+	interval := mapRenderInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastBalance := time.Time{}
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		if v := mapRenderInterval(); v != interval {
+			interval = v
+			ticker.Reset(interval)
+		}
+		removeKickedBots()
+		if now.Sub(lastBalance) >= botBalanceEvery {
+			balanceBots()
+			lastBalance = now
+		}
+		playing := matchAllowsPlay()
+		for _, b := range bots {
+			b.think(now, playing)
+		}
+		stepBotBullets(interval.Seconds())
+	}
+}
+
+// 有真人在线时用机器人补足到 min_players，真人增加时移除多余的机器人
+func balanceBots() {
+	cfg := model.Conf().Bots
+	humans := countPlayers()
+	want := 0
+	if humans > 0 {
+		want = max(0, cfg.MinPlayers-humans)
+	}
+
+	for len(bots) < want {
+		if !addBot(cfg.NamePrefix) {
+			break
+		}
+	}
+	for name, b := range bots {
+		if len(bots) <= want {
+			break
+		}
+		delete(bots, name)
+		releaseClient(b.client)
+		logging.Game.Info("bot removed", "event", "bot_leave", "player", name, "humans", humans)
+	}
+}
+
+// 移除被管理员踢出的机器人，空出的名额由 balanceBots 重新补足
+func removeKickedBots() {
+	for name, b := range bots {
+		model.ClientsMu.Lock()
+		kicked := b.client.Kicked
+		model.ClientsMu.Unlock()
+		if !kicked {
+			continue
+		}
+		delete(bots, name)
+		releaseClient(b.client)
+		logging.Game.Info("bot kicked", "event", "kick", "player", name)
+	}
+}
+
+func addBot(prefix string) bool {
+	var name string
+	for i := 1; i <= 1000; i++ {
+		candidate := fmt.Sprintf("%s%d", prefix, i)
+		if reserveUsername(candidate) == nil {
+			name = candidate
+			break
+		}
+	}
+	if name == "" {
+		logging.Game.Warn("no free bot name", "prefix", prefix)
+		return false
+	}
+
+	now := time.Now()
+	client := &model.Client{
+		ID:         name,
+		Bot:        true,
+		LastActive: now,
+		JoinedAt:   now,
+	}
+	client.Tank = allocateTank(name)
+	if client.Tank == nil {
+		logging.Game.Warn("no available spawn point", "player", name)
+		removeUsername(name)
+		return false
+	}
+	client.Tank.Bot = true
+
+	model.ClientsMu.Lock()
+	model.Clients[name] = client
+	model.ClientsMu.Unlock()
+
+	bots[name] = &botBrain{client: client}
+	logging.Game.Info("bot joined", "event", "bot_join", "player", name, "x", client.Tank.LocalX, "y", client.Tank.LocalY)
+	return true
+}
+
+// 每个 tick 的决策：死亡后等待重生，否则追击最近的坦克，对齐后开火
+func (b *botBrain) think(now time.Time, playing bool) {
+	c := b.client
+	t := currentTank(c)
+	if t == nil {
+		return
+	}
+
+	if t.Status == model.StatusFree {
+		if b.diedAt.IsZero() {
+			b.diedAt = now
+			b.dir = model.DirNone
+		}
+		if now.Sub(b.diedAt) >= time.Duration(model.Conf().Bots.RespawnSeconds)*time.Second {
+			b.diedAt = time.Time{}
+			processRespawnPayload(model.RespawnPayload{Username: c.ID})
+		}
+		return
+	}
+	if !playing {
+		b.steer(model.DirNone, false)
+		return
+	}
+
+	target := nearestTank(t)
+	if target == nil {
+		b.steer(model.DirNone, false)
+		return
+	}
+
+	dx := int(target.LocalX) - int(t.LocalX)
+	dy := int(target.LocalY) - int(t.LocalY)
+	if dir, ok := aimDirection(dx, dy); ok && t.Reload == 0 &&
+		max(abs(dx), abs(dy)) <= model.Conf().Bots.FireRange &&
+		clearShot(t.LocalX, t.LocalY, dir, max(abs(dx), abs(dy))) {
+		b.steer(dir, true)
+		return
+	}
+
+	// 卡住时随机游走一段时间
+	if t.LocalX == b.lastX && t.LocalY == b.lastY && b.dir != model.DirNone {
+		b.stuck++
+	} else {
+		b.stuck = 0
+	}
+	b.lastX, b.lastY = t.LocalX, t.LocalY
+	if b.stuck >= botStuckTicks {
+		b.stuck = 0
+		b.wander = botWanderTicks
+		b.wanderTo = botDirs[rand.Intn(len(botDirs))]
+		b.path = nil
+	}
+	if b.wander > 0 {
+		b.wander--
+		b.steer(passableDirection(t, b.wanderTo), false)
+		return
+	}
+
+	b.steer(passableDirection(t, b.route(now, t, target)), false)
+}
+
+// 沿 A* 路径追击；找不到路径时直接朝目标移动
+func (b *botBrain) route(now time.Time, t, target *model.Tank) byte {
+	pos := pathfind.Point{X: int(t.LocalX), Y: int(t.LocalY)}
+	if len(b.path) == 0 || now.After(b.replanAt) {
+		b.path = pathfind.Find(pos, pathfind.Point{X: int(target.LocalX), Y: int(target.LocalY)})
+		b.replanAt = now.Add(botReplanEvery + time.Duration(rand.Int63n(int64(botReplanEvery/2))))
+	}
+	// 丢掉已经到达的途经点
+	for len(b.path) > 1 && max(abs(b.path[0].X-pos.X), abs(b.path[0].Y-pos.Y)) <= 1 {
+		b.path = b.path[1:]
+	}
+	if len(b.path) == 0 {
+		return chaseDirection(int(target.LocalX)-pos.X, int(target.LocalY)-pos.Y)
+	}
+	return deltaToDirection(sign(b.path[0].X-pos.X), sign(b.path[0].Y-pos.Y))
+}
+
+// 与真人相同，通过 type=15 的处理逻辑操作坦克；方向不变且不开火时不重复发送
+func (b *botBrain) steer(dir byte, fire bool) {
+	if dir == b.dir && !fire {
+		return
+	}
+	b.dir = dir
+	dx, dy := getDirectionDelta(dir)
+	op := model.OperatePayload{Up: dy < 0, Down: dy > 0, Left: dx < 0, Right: dx > 0}
+	if fire {
+		op.Action = "fire"
+	}
+	if se := processOperatePayload(b.client, op); se != nil {
+		launchBotBullet(se)
+	}
+}
+
+// 最近的其他存活坦克
+func nearestTank(self *model.Tank) *model.Tank {
+	var best *model.Tank
+	bestDist := math.MaxInt
+	for _, t := range GetActiveTanks() {
+		if t == self || t.Status != model.StatusTaken {
+			continue
+		}
+		d := abs(int(t.LocalX)-int(self.LocalX)) + abs(int(t.LocalY)-int(self.LocalY))
+		if d < bestDist {
+			best, bestDist = t, d
+		}
+	}
+	return best
+}
+
+// 目标在八个方向之一上时返回该方向
+func aimDirection(dx, dy int) (byte, bool) {
+	if dx == 0 && dy == 0 {
+		return model.DirNone, false
+	}
+	if dx != 0 && dy != 0 && abs(dx) != abs(dy) {
+		return model.DirNone, false
+	}
+	return deltaToDirection(sign(dx), sign(dy)), true
+}
+
+// 追击方向：先向偏差大的轴靠拢，偏差接近时斜向移动，便于对齐开火
+func chaseDirection(dx, dy int) byte {
+	ax, ay := abs(dx), abs(dy)
+	switch {
+	case ax > 2*ay:
+		return deltaToDirection(sign(dx), 0)
+	case ay > 2*ax:
+		return deltaToDirection(0, sign(dy))
+	default:
+		return deltaToDirection(sign(dx), sign(dy))
+	}
+}
+
+// 期望方向被河流、树林或坦克挡住时，依次尝试相邻的方向
+func passableDirection(t *model.Tank, want byte) byte {
+	if want == model.DirNone {
+		return want
+	}
+	start := 0
+	for i, d := range botDirs {
+		if d == want {
+			start = i
+		}
+	}
+	model.SpawnTanksMu.Lock()
+	defer model.SpawnTanksMu.Unlock()
+	for _, off := range []int{0, 1, -1, 2, -2, 3, -3} {
+		d := botDirs[(start+off+len(botDirs))%len(botDirs)]
+		if canStep(t.LocalX, t.LocalY, d) {
+			return d
+		}
+	}
+	return model.DirNone
+}
+
+// 与 moveTank 相同的移动规则，调用方需持有 SpawnTanksMu
+func canStep(x, y uint, dir byte) bool {
+	dx, dy := getDirectionDelta(dir)
+	nx, ny := int(x)+dx, int(y)+dy
+	if !isWithinBounds(nx, ny) || !canMoveTo(nx, ny) {
+		return false
+	}
+	if dx != 0 && dy != 0 {
+		return canMoveTo(nx, int(y)) || canMoveTo(int(x), ny)
+	}
+	return true
+}
+
+// 射线上是否有树林挡住
+func clearShot(x, y uint, dir byte, dist int) bool {
+	model.SpawnTanksMu.Lock()
+	defer model.SpawnTanksMu.Unlock()
+	dx, dy := getDirectionDelta(dir)
+	for i := 1; i < dist; i++ {
+		cx, cy := int(x)+dx*i, int(y)+dy*i
+		if !isWithinBounds(cx, cy) || blocksBullet(cx, cy) {
+			return false
+		}
+	}
+	return true
+}
+
+// 子弹可以越过河流，树林会挡住子弹；调用方需持有 SpawnTanksMu
+func blocksBullet(x, y int) bool {
+	return model.Map[y][x] == 3
+}
+
+// 按客户端的规则计算子弹起点与速度
+func launchBotBullet(se *model.ShotEvent) {
+	dx, dy := getDirectionDelta(se.Facing)
+	if dx == 0 && dy == 0 {
+		dx = 1
+	}
+	vx, vy := float64(dx), float64(dy)
+	if dx != 0 && dy != 0 {
+		vx, vy = vx*math.Sqrt2/2, vy*math.Sqrt2/2
+	}
+	botBullets = append(botBullets, &botBullet{
+		owner: se.Tank,
+		x:     float64(se.LocalX) + 0.5 + vx*0.6,
+		y:     float64(se.LocalY) + 0.5 + vy*0.6,
+		vx:    vx * botBulletSpeed,
+		vy:    vy * botBulletSpeed,
+	})
+}
+
+// 推进机器人子弹，出界或撞到树林时消失，击中坦克时按 type=17 处理
+func stepBotBullets(seconds float64) {
+	if len(botBullets) == 0 {
+		return
+	}
+	tanks := GetActiveTanks()
+	steps := int(math.Ceil(botBulletSpeed * seconds / botBulletStep))
+
+	var hits []model.HitPayload
+	alive := botBullets[:0]
+	model.SpawnTanksMu.Lock()
+	for _, b := range botBullets {
+		if victim, gone := b.advance(tanks, seconds/float64(steps), steps); victim != "" {
+			hits = append(hits, model.HitPayload{Username: b.owner, Victim: victim})
+		} else if !gone {
+			alive = append(alive, b)
+		}
+	}
+	model.SpawnTanksMu.Unlock()
+	botBullets = alive
+
+	for _, h := range hits {
+		processHitPayload(h)
+	}
+}
+
+func (b *botBullet) advance(tanks []*model.Tank, dt float64, steps int) (string, bool) {
+	for i := 0; i < steps; i++ {
+		b.x += b.vx * dt
+		b.y += b.vy * dt
+		cx, cy := int(math.Floor(b.x)), int(math.Floor(b.y))
+		if !isWithinBounds(cx, cy) || blocksBullet(cx, cy) {
+			return "", true
+		}
+		for _, t := range tanks {
+			if t.ID == b.owner || t.Status != model.StatusTaken {
+				continue
+			}
+			if math.Hypot(b.x-float64(t.LocalX)-0.5, b.y-float64(t.LocalY)-0.5) < botHitRadius {
+				return t.ID, true
+			}
+		}
+	}
+	return "", false
+}
+
+func deltaToDirection(dx, dy int) byte {
+	for _, d := range botDirs {
+		if ddx, ddy := getDirectionDelta(d); ddx == dx && ddy == dy {
+			return d
+		}
+	}
+	return model.DirNone
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
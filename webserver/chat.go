@@ -0,0 +1,261 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+)
+
+var (
+	chatHistory   []*model.ChatMessage // 最近的公共聊天，最旧的在前
+	chatHistoryMu sync.Mutex
+
+	mutes   = make(map[string]int64) // 规范化用户名 -> 禁言截止时间（unix 毫秒），0 表示直到解除
+	mutesMu sync.Mutex
+)
+
+// 处理 type=22，出错时以 type=4 告知发送者
+func handleChat(c *model.Client, p model.ChatPayload) {
+	cfg := model.Conf().Chat
+	if !cfg.Enabled {
+		sendNotice(c, "chat is disabled")
+		return
+	}
+
+	text := strings.TrimSpace(p.Text)
+	switch {
+	case text == "":
+		sendNotice(c, "chat message is empty")
+		return
+	case cfg.MaxLength > 0 && utf8.RuneCountInString(text) > cfg.MaxLength:
+		sendNotice(c, fmt.Sprintf("chat message must be at most %d characters", cfg.MaxLength))
+		return
+	case strings.IndexFunc(text, unicode.IsControl) >= 0:
+		sendNotice(c, "chat message contains control characters")
+		return
+	}
+	if until, muted := mutedUntil(c.ID); muted {
+		sendNotice(c, muteNotice(until))
+		return
+	}
+
+	msg := &model.ChatMessage{
+		From:    c.ID,
+		Channel: p.Channel,
+		Text:    filterWords(text, cfg.FilterWords),
+		Time:    time.Now().UnixMilli(),
+	}
+	switch p.Channel {
+	case model.ChatAll, "":
+		msg.Channel = model.ChatAll
+		appendChatHistory(msg, cfg.HistorySize)
+		data, err := RePackWebMessageJson(13, msg, "broadcast message gamer")
+		if err != nil {
+			logging.Game.Error("failed to marshal chat", "err", err)
+			return
+		}
+		broadcastToAllClients(data, "Broadcast chat")
+		logging.Game.Debug("chat", "event", "chat", "player", c.ID, "channel", msg.Channel, "text", msg.Text)
+
+	case model.ChatTeam:
+		if c.Team == "" {
+			sendNotice(c, "you are not in a team, set team in type=16 when joining")
+			return
+		}
+		msg.Team = c.Team
+		data, err := RePackWebMessageJson(13, msg, c.Team)
+		if err != nil {
+			logging.Game.Error("failed to marshal chat", "err", err)
+			return
+		}
+		// 发给同队的在线玩家，包括发送者自己
+		for _, to := range teammates(c.Team) {
+			sendToClient(to, data)
+		}
+		logging.Game.Debug("chat", "event", "chat", "player", c.ID, "channel", msg.Channel, "team", c.Team)
+
+	case model.ChatWhisper:
+		model.ClientsMu.Lock()
+		to := model.Clients[p.To]
+		online := to != nil && !to.Suspended && !to.Bot
+		model.ClientsMu.Unlock()
+		if !online || to == c {
+			sendNotice(c, fmt.Sprintf("player %s is not online", p.To))
+			return
+		}
+		msg.To = to.ID
+		data, err := RePackWebMessageJson(13, msg, to.ID)
+		if err != nil {
+			logging.Game.Error("failed to marshal chat", "err", err)
+			return
+		}
+		// 发给接收者，并回显给发送者
+		sendToClient(to, data)
+		sendToClient(c, data)
+		logging.Game.Debug("chat", "event", "chat", "player", c.ID, "channel", msg.Channel, "to", to.ID)
+
+	default:
+		sendNotice(c, fmt.Sprintf("unknown chat channel %q, use all, team or whisper", p.Channel))
+	}
+}
+
+// 队伍名最多字符数
+const maxTeamLength = 16
+
+// 检查 type=16 中声明的队伍名，为空表示不加入队伍
+func validateTeam(team string) error {
+	if team == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(team) > maxTeamLength {
+		return fmt.Errorf("team name must be at most %d characters", maxTeamLength)
+	}
+	if strings.TrimSpace(team) != team {
+		return errors.New("team name must not start or end with spaces")
+	}
+	if strings.IndexFunc(team, func(r rune) bool {
+		return unicode.IsControl(r) || r == unicode.ReplacementChar
+	}) >= 0 {
+		return errors.New("team name contains control or invalid characters")
+	}
+	return nil
+}
+
+// 同队的在线玩家（不含断线中的玩家），队伍名与用户名一样按规范化后比较
+func teammates(team string) []*model.Client {
+	key := model.NormalizeUsername(team)
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+	var out []*model.Client
+	for _, c := range model.Clients {
+		if c.Team != "" && !c.Suspended && model.NormalizeUsername(c.Team) == key {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// 以 type=4 给单个客户端发送提示
+func sendNotice(c *model.Client, notice string) {
+	data, err := RePackWebMessageJson(4, model.NoticePayload{Notice: notice}, c.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal notice", "err", err)
+		return
+	}
+	sendToClient(c, data)
+}
+
+// 屏蔽词替换为等长的 *，不区分大小写
+func filterWords(text string, words []string) string {
+	if len(words) == 0 {
+		return text
+	}
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	for _, w := range words {
+		word := []rune(w)
+		for i, r := range word {
+			word[i] = unicode.ToLower(r)
+		}
+		if len(word) == 0 {
+			continue
+		}
+		for i := 0; i+len(word) <= len(lower); i++ {
+			if !runesEqual(lower[i:i+len(word)], word) {
+				continue
+			}
+			for j := range word {
+				runes[i+j] = '*'
+			}
+			i += len(word) - 1
+		}
+	}
+	return string(runes)
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func appendChatHistory(msg *model.ChatMessage, size int) {
+	chatHistoryMu.Lock()
+	defer chatHistoryMu.Unlock()
+	if size <= 0 {
+		chatHistory = nil
+		return
+	}
+	chatHistory = append(chatHistory, msg)
+	if n := len(chatHistory) - size; n > 0 {
+		chatHistory = append(chatHistory[:0:0], chatHistory[n:]...)
+	}
+}
+
+// type=1 中携带的聊天记录
+func recentChat() []*model.ChatMessage {
+	chatHistoryMu.Lock()
+	defer chatHistoryMu.Unlock()
+	if len(chatHistory) == 0 {
+		return nil
+	}
+	return append([]*model.ChatMessage(nil), chatHistory...)
+}
+
+// 禁言，minutes 为 0 表示直到解除
+func mutePlayer(username string, minutes int) int64 {
+	var until int64
+	if minutes > 0 {
+		until = time.Now().Add(time.Duration(minutes) * time.Minute).UnixMilli()
+	}
+	mutesMu.Lock()
+	mutes[model.NormalizeUsername(username)] = until
+	mutesMu.Unlock()
+	return until
+}
+
+func unmutePlayer(username string) bool {
+	key := model.NormalizeUsername(username)
+	mutesMu.Lock()
+	defer mutesMu.Unlock()
+	_, ok := mutes[key]
+	delete(mutes, key)
+	return ok
+}
+
+// 发给被禁言玩家的说明
+func muteNotice(until int64) string {
+	if until == 0 {
+		return "you are muted"
+	}
+	return "you are muted until " + time.UnixMilli(until).UTC().Format(time.RFC3339)
+}
+
+// 是否被禁言，过期的禁言顺便删除
+func mutedUntil(username string) (int64, bool) {
+	key := model.NormalizeUsername(username)
+	mutesMu.Lock()
+	defer mutesMu.Unlock()
+	until, ok := mutes[key]
+	if !ok {
+		return 0, false
+	}
+	if until != 0 && time.Now().UnixMilli() >= until {
+		delete(mutes, key)
+		return 0, false
+	}
+	return until, true
+}
@@ -0,0 +1,66 @@
+package webserver
+
+import (
+	"strconv"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"github.com/gorilla/websocket"
+)
+
+// 启动心跳：定时 ping，收到 pong 时延长读超时并记录往返时间。
+// 返回读循环每收到一条消息时调用的 extend；该连接不发送 ping 时不设读超时，
+// 否则空闲但正常的客户端会因为没有 pong 可回而在 pong_timeout 后被断开
+func startHeartbeat(client *model.Client, conn *websocket.Conn, done <-chan struct{}) (extend func()) {
+	cfg := model.Conf().Heartbeat
+	if cfg.PingIntervalSeconds <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return func() {}
+	}
+	extend = func() { extendReadDeadline(conn) }
+	extend()
+
+	conn.SetPongHandler(func(appData string) error {
+		extend()
+		if sent, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			rtt := time.Since(time.Unix(0, sent))
+			model.ClientsMu.Lock()
+			client.RTT = rtt
+			model.ClientsMu.Unlock()
+		}
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.PingIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// ping 载荷为发送时间，pong 原样带回
+				payload := strconv.FormatInt(time.Now().UnixNano(), 10)
+				err := conn.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(5*time.Second))
+				if err != nil {
+					logging.Network.Info("ping failed", "player", client.ID, "err", err)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	return extend
+}
+
+// 延长读超时，超时后 ReadMessage 返回错误并走正常的断线清理
+func extendReadDeadline(conn *websocket.Conn) {
+	timeout := model.Conf().Heartbeat.PongTimeoutSeconds
+	if timeout <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+}
@@ -0,0 +1,109 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+)
+
+// 挂机检测循环
+func IdleLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			checkIdleClients(now)
+		}
+	}
+}
+
+// 标记挂机坦克，超时的玩家转为观战或断开
+func checkIdleClients(now time.Time) {
+	cfg := model.Conf().Idle
+	if cfg.AFKSeconds <= 0 && cfg.KickSeconds <= 0 {
+		return
+	}
+
+	var idle []*model.Client
+	model.ClientsMu.Lock()
+	for _, c := range model.Clients {
+		if c.Suspended || c.Tank == nil || c.Bot {
+			continue
+		}
+		since := now.Sub(c.LastActive)
+		if cfg.AFKSeconds > 0 && since >= time.Duration(cfg.AFKSeconds)*time.Second {
+			c.Tank.AFK = true
+		}
+		if cfg.KickSeconds > 0 && since >= time.Duration(cfg.KickSeconds)*time.Second {
+			idle = append(idle, c)
+		}
+	}
+	model.ClientsMu.Unlock()
+
+	for _, c := range idle {
+		reason := fmt.Sprintf("idle for %d seconds", cfg.KickSeconds)
+		if cfg.Action == model.IdleActionDisconnect {
+			kickClient(c, reason)
+		} else {
+			moveToSpectator(c, reason)
+		}
+	}
+}
+
+// 收回坦克，玩家保留连接继续接收广播
+func moveToSpectator(client *model.Client, reason string) {
+	model.ClientsMu.Lock()
+	tank := client.Tank
+	client.Tank = nil
+	model.ClientsMu.Unlock()
+	if tank == nil {
+		return
+	}
+	FreeTank(tank)
+
+	tankchange := model.TankChangePayload{
+		Username: client.ID,
+		TurnTo:   false,
+		X:        tank.LocalX,
+		Y:        tank.LocalY,
+	}
+	data, err := RePackWebMessageJson(5, tankchange, "")
+	if err != nil {
+		logging.Game.Error("failed to marshal tank change", "err", err)
+	} else {
+		broadcastToAllClients(data, "Broadcast change")
+	}
+
+	notice := model.NoticePayload{Notice: "moved to spectators: " + reason + ", send respawn to rejoin"}
+	data, err = RePackWebMessageJson(4, notice, client.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal notice", "err", err)
+		return
+	}
+	sendToClient(client, data)
+	logging.Game.Info("moved to spectators", "event", "spectate", "player", client.ID, "reason", reason)
+}
+
+// 观战玩家重新分配坦克
+func rejoinFromSpectator(client *model.Client) {
+	tank := allocateTank(client.ID)
+	if tank == nil {
+		logging.Game.Warn("no available spawn point", "player", client.ID)
+		sendNoSpawnNotice(client, client.ID)
+		return
+	}
+	model.ClientsMu.Lock()
+	client.LastActive = time.Now()
+	client.Tank = tank
+	model.ClientsMu.Unlock()
+	SendConfig(client)
+	logging.Game.Info("rejoined from spectators", "event", "rejoin", "player", client.ID,
+		"x", tank.LocalX, "y", tank.LocalY)
+}
@@ -1,39 +1,56 @@
 package webserver
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math/rand"
 	"time"
 
+	"example.com/lite_demo/logging"
 	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/metrics"
 	"example.com/lite_demo/model"
 )
 
-const (
-	ColorReset = "\033[0m"
-	ColorRed   = "\033[38;2;255;0;0m"
-	ColorGreen = "\033[38;2;0;255;0m"
-	ColorBlue  = "\033[38;2;0;0;255m"
-)
+// 地图刷新间隔，移动、子弹与装填按此步进
+func mapRenderInterval() time.Duration {
+	return time.Duration(model.Conf().Game.MapRenderMS) * time.Millisecond
+}
 
-var TANK_RELOAD_VALUE = model.TANK_RELOAD_SECONDS * 1000 / model.MAP_RENDER_MS * 5
+// 开火后的装填值，每次地图刷新减 5
+func reloadValue() uint {
+	g := model.Conf().Game
+	return uint(g.ReloadSeconds * 1000 / g.MapRenderMS * 5)
+}
 
-// 更新游戏状态
-func MapRenderloop() {
-	ticker := time.NewTicker(model.MAP_RENDER_MS * time.Millisecond)
+// 更新游戏状态，ctx 取消时退出
+func MapRenderloop(ctx context.Context) {
+	interval := mapRenderInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		// 配置热加载修改了刷新间隔
+		if v := mapRenderInterval(); v != interval {
+			interval = v
+			ticker.Reset(interval)
+		}
 		// 遍历坦克，把每个活跃的坦克标记到地图上
 		// num := runtime.NumGoroutine()
 		// fmt.Printf("当前 goroutine 数量：%d\n", num)
 		model.SpawnTanksMu.Lock()
 		// model.ShotEventsMu.Lock()
 		// model.ShotEvents = model.ShotEvents[0:0]
+		playing := matchAllowsPlay()
 		for _, t := range model.SpawnTanks {
 			//坦克移动
-			if t.Status == model.StatusTaken {
+			if t.Status == model.StatusTaken && playing {
 				gamemap.MarkTankOnMap(t, 0)
 				moveTank(t)
 				// if t.Trigger { //更新坦克状态时，如果坦克扳机按下则发射子弹
@@ -47,6 +64,7 @@ func MapRenderloop() {
 		}
 		model.SpawnTanksMu.Unlock()
 		// model.ShotEventsMu.Unlock()
+		metrics.ObserveTick(metrics.LoopMapRender, start)
 	}
 
 }
@@ -58,7 +76,7 @@ func OpenFire(t *model.Tank) *model.ShotEvent {
 	shotevent.Tank = t.ID
 	shotevent.LocalX = t.LocalX
 	shotevent.LocalY = t.LocalY
-	t.Reload = uint(TANK_RELOAD_VALUE)
+	t.Reload = reloadValue()
 	t.Trigger = false
 	//printTankShape(t)
 	//log.Printf("shoting shotevent=%+v\n", shotevent)
@@ -172,13 +190,13 @@ func getDirectionDelta(dir byte) (int, int) {
 	}
 }
 
-// 判断新坐标是否在地图内
+// 判断新坐标是否在地图内，调用方需持有 SpawnTanksMu
 func isWithinBounds(x, y int) bool {
-	return x >= 0 && x < int(model.MAP_SIZE_X) &&
-		y >= 0 && y < int(model.MAP_SIZE_Y)
+	return x >= 0 && x < int(model.MapSizeX) &&
+		y >= 0 && y < int(model.MapSizeY)
 }
 
-// 判断目标位置是否可以移动（不被占用）
+// 判断目标位置是否可以移动（不被占用），调用方需持有 SpawnTanksMu
 func canMoveTo(x, y int) bool {
 	return model.Map[y][x] == 0
 }
@@ -202,6 +220,8 @@ func BuildGameState() *model.GameState {
 	return &model.GameState{
 		Tanks:      GetActiveTanks(),
 		ShotEvents: model.ShotEvents,
+		Match:      CurrentMatch(),
+		ServerTime: time.Now().UnixMicro(),
 		// Items: GetActiveItems(),
 		// Map: GetMap(),
 	}
@@ -211,14 +231,14 @@ func BuildGameState() *model.GameState {
 func InitSpawnTanks() {
 
 	coords := [][2]uint{
-		{1, 1},                    // 上左
-		{model.MAP_SIZE_X / 2, 1}, // 上中
-		{model.MAP_SIZE_X - 2, 1}, // 上右
-		{model.MAP_SIZE_X - 2, model.MAP_SIZE_Y / 2}, // 右中
-		{model.MAP_SIZE_X - 2, model.MAP_SIZE_Y - 2}, // 下右
-		{model.MAP_SIZE_X / 2, model.MAP_SIZE_Y - 2}, // 下中
-		{1, model.MAP_SIZE_Y - 2},                    // 下左
-		{1, model.MAP_SIZE_Y / 2},                    // 左中
+		{1, 1},                                   // 上左
+		{model.MapSizeX / 2, 1},                  // 上中
+		{model.MapSizeX - 2, 1},                  // 上右
+		{model.MapSizeX - 2, model.MapSizeY / 2}, // 右中
+		{model.MapSizeX - 2, model.MapSizeY - 2}, // 下右
+		{model.MapSizeX / 2, model.MapSizeY - 2}, // 下中
+		{1, model.MapSizeY - 2},                  // 下左
+		{1, model.MapSizeY / 2},                  // 左中
 	}
 
 	for _, c := range coords {
@@ -236,13 +256,22 @@ func InitSpawnTanks() {
 	}
 }
 
-// 分配出生点
+// 分配出生点并广播 type=5
 func allocateTank(id string) *model.Tank {
 	model.SpawnTanksMu.Lock()
-	defer model.SpawnTanksMu.Unlock()
+	t := spawnTank(id)
+	model.SpawnTanksMu.Unlock()
+
+	// 广播会取 ClientsMu，必须在释放 SpawnTanksMu 之后
+	announceSpawn(t)
+	return t
+}
+
+// 在随机空地上放置坦克，调用方需持有 SpawnTanksMu
+func spawnTank(id string) *model.Tank {
 	for {
-		r_x := rand.Intn(int(model.MAP_SIZE_X))
-		r_y := rand.Intn(int(model.MAP_SIZE_Y))
+		r_x := rand.Intn(int(model.MapSizeX))
+		r_y := rand.Intn(int(model.MapSizeY))
 		if model.Map[r_y][r_x] == 0 {
 			t := model.Tank{
 				LocalX:      uint(r_x),
@@ -256,29 +285,41 @@ func allocateTank(id string) *model.Tank {
 			}
 			model.SpawnTanks = append(model.SpawnTanks, &t)
 			gamemap.MarkTankOnMap(&t, 1)
-			tankchange := model.TankChangePayload{
-				Username: id,
-				TurnTo:   true,
-				X:        uint(r_x),
-				Y:        uint(r_y),
-			}
-			data, err := RePackWebMessageJson(5, tankchange, "")
-			if err != nil {
-				log.Println("Failed to marshal game state:", err)
-			}
-			broadcastToAllClients(data, "Broadcast change")
 			return &t
 		}
 	}
 }
 
-// 释放出生点
+// 广播新坦克出现
+func announceSpawn(t *model.Tank) {
+	tankchange := model.TankChangePayload{
+		Username: t.ID,
+		TurnTo:   true,
+		X:        t.LocalX,
+		Y:        t.LocalY,
+	}
+	data, err := RePackWebMessageJson(5, tankchange, "")
+	if err != nil {
+		logging.Game.Error("failed to marshal tank change", "err", err)
+		return
+	}
+	broadcastToAllClients(data, "Broadcast change")
+}
+
+// 玩家当前的坦克，观战或已释放时为 nil；client.Tank 由 ClientsMu 保护
+func currentTank(c *model.Client) *model.Tank {
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+	return c.Tank
+}
+
+// 释放出生点。换图后旧坦克已不在 SpawnTanks 中，不能再按其坐标改写新地图
 func FreeTank(target *model.Tank) {
 	model.SpawnTanksMu.Lock()
 	defer model.SpawnTanksMu.Unlock()
-	gamemap.MarkTankOnMap(target, 0)
 	for i, t := range model.SpawnTanks {
 		if t == target {
+			gamemap.MarkTankOnMap(target, 0)
 			// 用最后一个覆盖自己
 			model.SpawnTanks[i] = model.SpawnTanks[len(model.SpawnTanks)-1]
 			model.SpawnTanks = model.SpawnTanks[:len(model.SpawnTanks)-1]
@@ -300,26 +341,5 @@ func removeUsername(username string) {
 	}
 	model.Usernames = newList
 
-	log.Printf("已删除用户名: %s", username)
-}
-
-func isUsernameLegal(username string) bool {
-	// 先判断 username 是否为空
-	if username == "" {
-		return false
-	}
-
-	// 遍历现有的 model.Usernames
-	for _, u := range model.Usernames {
-		if u == "" {
-			continue
-		}
-		if u == username {
-			// 找到相同的
-			return false
-		}
-	}
-
-	// 非空且不重复
-	return true
+	logging.Network.Debug("已删除用户名", "player", username)
 }
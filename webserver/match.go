@@ -0,0 +1,332 @@
+package webserver
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"example.com/lite_demo/logging"
+	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/replay"
+)
+
+// 启动时载入第一局地图
+func InitMatch() {
+	mapName := loadRoundMap(1)
+	model.MatchMu.Lock()
+	model.Match.Round = 1
+	model.Match.MapName = mapName
+	model.MatchMu.Unlock()
+}
+
+// 比赛循环：热身 -> 倒计时 -> 进行中 -> 结算 -> 下一局
+func MatchLoop(ctx context.Context) {
+	enterPhase(model.PhaseWarmup, model.Conf().Match.WarmupSeconds)
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stepMatch(now)
+		}
+	}
+}
+
+// 推进比赛阶段
+func stepMatch(now time.Time) {
+	cfg := model.Conf().Match
+
+	model.MatchMu.Lock()
+	phase := model.Match.Phase
+	expired := model.Match.EndsAt != 0 && now.UnixMilli() >= model.Match.EndsAt
+	model.MatchMu.Unlock()
+
+	players := countPlayers()
+
+	switch phase {
+	case model.PhaseWarmup:
+		if !expired {
+			return
+		}
+		if players < cfg.MinPlayers || players == 0 {
+			// 人数不足，继续热身
+			enterPhase(model.PhaseWarmup, cfg.WarmupSeconds)
+			return
+		}
+		enterPhase(model.PhaseCountdown, cfg.CountdownSeconds)
+	case model.PhaseCountdown:
+		if players == 0 {
+			enterPhase(model.PhaseWarmup, cfg.WarmupSeconds)
+			return
+		}
+		if expired {
+			resetScores()
+			enterPhase(model.PhaseLive, cfg.TimeLimitSeconds)
+		}
+	case model.PhaseLive:
+		if players == 0 {
+			logging.Game.Info("所有玩家已离开，回到热身阶段", "event", "match_abort")
+			enterPhase(model.PhaseWarmup, cfg.WarmupSeconds)
+			return
+		}
+		if expired {
+			endMatch("time")
+		}
+	case model.PhaseEnded:
+		if expired {
+			startNextRound()
+			enterPhase(model.PhaseWarmup, model.Conf().Match.WarmupSeconds)
+		}
+	}
+}
+
+// 切换比赛阶段并广播
+func enterPhase(phase byte, seconds int) {
+	model.MatchMu.Lock()
+	state := setPhase(phase, seconds)
+	model.MatchMu.Unlock()
+
+	announcePhase(state)
+}
+
+// 修改阶段与结束时间，调用方需持有 MatchMu
+func setPhase(phase byte, seconds int) model.MatchState {
+	model.Match.Phase = phase
+	model.Match.ScoreLimit = model.Conf().Match.ScoreLimit
+	if seconds > 0 {
+		model.Match.EndsAt = time.Now().Add(time.Duration(seconds) * time.Second).UnixMilli()
+	} else {
+		model.Match.EndsAt = 0
+	}
+	return model.Match
+}
+
+// 在锁外记录并广播阶段变更
+func announcePhase(state model.MatchState) {
+	phase := state.Phase
+	logging.Game.Info("match phase", "event", "match_phase", "round", state.Round, "phase", phase)
+	if phase == model.PhaseLive {
+		startRecording(state)
+	}
+	data, err := RePackWebMessageJson(8, state, "broadcast message gamer")
+	if err != nil {
+		logging.Game.Error("failed to marshal match state", "err", err)
+	} else {
+		broadcastToAllClients(data, "Broadcast match")
+	}
+	if phase == model.PhaseWarmup {
+		// 比赛中途所有玩家离开
+		replay.Stop()
+	}
+}
+
+// 获取比赛状态快照
+func CurrentMatch() *model.MatchState {
+	model.MatchMu.Lock()
+	defer model.MatchMu.Unlock()
+	state := model.Match
+	return &state
+}
+
+// 当前阶段是否允许移动、开火与计分
+func matchAllowsPlay() bool {
+	model.MatchMu.Lock()
+	defer model.MatchMu.Unlock()
+	return model.Match.Phase == model.PhaseWarmup || model.Match.Phase == model.PhaseLive
+}
+
+// 当前是否处于正式比赛阶段（统计只记录正式比赛）
+func matchIsLive() bool {
+	model.MatchMu.Lock()
+	defer model.MatchMu.Unlock()
+	return model.Match.Phase == model.PhaseLive
+}
+
+// 命中后检查是否达到分数上限
+func checkScoreLimit(point int) {
+	model.MatchMu.Lock()
+	reached := model.Match.Phase == model.PhaseLive &&
+		model.Match.ScoreLimit > 0 && point >= model.Match.ScoreLimit
+	model.MatchMu.Unlock()
+
+	if reached {
+		endMatch("score")
+	}
+}
+
+// 结束比赛并发送结算
+func endMatch(reason string) {
+	// 检查与切换在同一临界区内完成，同时到达的计分与超时只有一个能结算
+	model.MatchMu.Lock()
+	if model.Match.Phase != model.PhaseLive {
+		model.MatchMu.Unlock()
+		return
+	}
+	state := setPhase(model.PhaseEnded, model.Conf().Match.ResultsSeconds)
+	round := state.Round
+	model.MatchMu.Unlock()
+
+	result := model.MatchResultPayload{
+		Round:     round,
+		Reason:    reason,
+		Standings: buildStandings(),
+	}
+	if len(result.Standings) > 0 {
+		result.Winner = result.Standings[0].Username
+	}
+
+	announcePhase(state)
+
+	data, err := RePackWebMessageJson(9, result, "broadcast message gamer")
+	if err != nil {
+		logging.Game.Error("failed to marshal match result", "err", err)
+		return
+	}
+	logging.Game.Info("match ended", "event", "match_end", "round", round, "reason", reason, "winner", result.Winner)
+	broadcastToAllClients(data, "Broadcast result")
+	replay.Stop()
+}
+
+// 计算排名
+func buildStandings() []*model.Standing {
+	model.ClientsMu.Lock()
+	standings := make([]*model.Standing, 0, len(model.Clients))
+	for _, c := range model.Clients {
+		if c.Tank == nil {
+			continue
+		}
+		standings = append(standings, &model.Standing{
+			Username: c.ID,
+			Point:    c.Tank.Point,
+		})
+	}
+	model.ClientsMu.Unlock()
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Point != standings[j].Point {
+			return standings[i].Point > standings[j].Point
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	for i, s := range standings {
+		s.Rank = i + 1
+	}
+	return standings
+}
+
+// 清零分数
+func resetScores() {
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+	for _, c := range model.Clients {
+		if c.Tank != nil {
+			c.Tank.Point = 0
+		}
+	}
+}
+
+// 当前在线玩家数（不含观战与机器人）
+func countPlayers() int {
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+	n := 0
+	for _, c := range model.Clients {
+		if c.Tank != nil && !c.Bot {
+			n++
+		}
+	}
+	return n
+}
+
+// 下一局：换图并为所有玩家重新分配坦克
+func startNextRound() {
+	model.MatchMu.Lock()
+	model.Match.Round++
+	round := model.Match.Round
+	model.MatchMu.Unlock()
+
+	mapName, players, _ := changeMap(func() (string, error) {
+		return loadRoundMap(round), nil
+	}, false)
+	logging.Game.Info("round ready", "event", "round_start", "round", round, "map", mapName, "players", players)
+}
+
+// 换图：load 载入新地形后为所有玩家重新分配坦克并重发 type=1，keepScores 为 false 时分数清零；
+// load 失败时地形不变，坦克留在原处。返回地图名与玩家数。
+// 替换地形与所有玩家的坦克在同一临界区内完成，之后不会再有玩家持有旧地图上的坦克
+func changeMap(load func() (string, error), keepScores bool) (string, int, error) {
+	model.ClientsMu.Lock()
+	model.SpawnTanksMu.Lock()
+	for _, t := range model.SpawnTanks {
+		gamemap.MarkTankOnMap(t, 0)
+	}
+	mapName, err := load()
+	if err != nil {
+		for _, t := range model.SpawnTanks {
+			gamemap.MarkTankOnMap(t, 1)
+		}
+		model.SpawnTanksMu.Unlock()
+		model.ClientsMu.Unlock()
+		return "", 0, err
+	}
+	model.SpawnTanks = nil
+	clients := make([]*model.Client, 0, len(model.Clients))
+	for _, c := range model.Clients {
+		if c.Tank == nil {
+			continue
+		}
+		t := spawnTank(c.ID)
+		if keepScores {
+			t.Point = c.Tank.Point
+		}
+		t.Bot = c.Bot
+		c.Tank = t
+		clients = append(clients, c)
+	}
+	model.SpawnTanksMu.Unlock()
+	model.ClientsMu.Unlock()
+
+	model.MatchMu.Lock()
+	model.Match.MapName = mapName
+	model.MatchMu.Unlock()
+
+	// 正在录制时写入新地形，回放播放与跳转时据此切换地图
+	if data, err := RePackWebMessageJson(1, spectatorMapConfig("replay"), "replay"); err != nil {
+		logging.Game.Error("failed to marshal replay config", "err", err)
+	} else {
+		replay.Record(data)
+	}
+
+	// 地形较大，逐个发送较慢，在锁外进行
+	for _, c := range clients {
+		if t := currentTank(c); t != nil {
+			announceSpawn(t)
+		}
+	}
+	for _, c := range clients {
+		SendConfig(c)
+	}
+	resendSpectatorConfig()
+	return mapName, len(clients), nil
+}
+
+// 按轮换列表载入地图，列表为空或载入失败时随机生成
+func loadRoundMap(round int) string {
+	rotation := model.Conf().Match.MapRotation
+	if len(rotation) > 0 {
+		path := rotation[(round-1)%len(rotation)]
+		if err := gamemap.LoadMapFile(path); err == nil {
+			return filepath.Base(path)
+		} else {
+			logging.Map.Warn("载入地图失败，改为随机生成", "path", path, "err", err)
+		}
+	}
+	gamemap.Maprandom()
+	return "random"
+}
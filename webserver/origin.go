@@ -0,0 +1,41 @@
+package webserver
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/metrics"
+	"example.com/lite_demo/model"
+)
+
+// websocket 升级时检查 Origin，防止玩家访问的其他网站以玩家的网络身份连接服务端
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || originAllowed(origin, r.Host, model.Conf().Origins) {
+		return true
+	}
+	logging.Network.Warn("rejected websocket origin", "origin", origin,
+		"remote", r.RemoteAddr, "path", r.URL.Path)
+	metrics.OriginRejected()
+	return false
+}
+
+// 同源页面总是允许；allowed 中的 * 匹配除 / 外的任意字符，比较时忽略大小写
+func originAllowed(origin, host string, cfg model.OriginsConfig) bool {
+	if cfg.AllowAll {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, p := range cfg.Allowed {
+		if ok, _ := path.Match(strings.ToLower(p), origin); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package webserver
+
+import (
+	"sync"
+	"time"
+
+	"example.com/lite_demo/model"
+)
+
+// 令牌桶
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(cfg model.BucketConfig) *tokenBucket {
+	return &tokenBucket{
+		rate:   cfg.Rate,
+		burst:  float64(cfg.Burst),
+		tokens: float64(cfg.Burst),
+		last:   time.Now(),
+	}
+}
+
+// 取一个令牌，rate 为 0 时不限速
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 单个连接的限速器，只在该连接的读循环中使用
+type clientLimiter struct {
+	frame, move, fire, hit, respawn, chat *tokenBucket
+
+	kickAfter   int
+	window      time.Duration
+	windowStart time.Time
+	windowDrops int
+}
+
+func newClientLimiter() *clientLimiter {
+	cfg := model.Conf().RateLimit
+	return &clientLimiter{
+		frame:       newTokenBucket(cfg.Frame),
+		move:        newTokenBucket(cfg.Move),
+		fire:        newTokenBucket(cfg.Fire),
+		hit:         newTokenBucket(cfg.Hit),
+		respawn:     newTokenBucket(cfg.Respawn),
+		chat:        newTokenBucket(cfg.Chat),
+		kickAfter:   cfg.KickAfterDrops,
+		window:      time.Duration(cfg.WindowSeconds) * time.Second,
+		windowStart: time.Now(),
+	}
+}
+
+// 每条消息在解析之前先取一个令牌，不允许时记一次丢弃
+func (l *clientLimiter) allowFrame(now time.Time) bool {
+	if l.frame.allow(now) {
+		return true
+	}
+	l.drop(now)
+	return false
+}
+
+// 按消息类型取令牌，不允许时记一次丢弃
+func (l *clientLimiter) allow(payload interface{}, now time.Time) bool {
+	ok := true
+	switch v := payload.(type) {
+	case model.OperatePayload:
+		ok = l.move.allow(now)
+		if ok && v.Action == "fire" {
+			ok = l.fire.allow(now)
+		}
+	case model.HitPayload:
+		ok = l.hit.allow(now)
+	case model.RespawnPayload:
+		ok = l.respawn.allow(now)
+	case model.ChatPayload:
+		ok = l.chat.allow(now)
+	}
+	if ok {
+		return true
+	}
+	l.drop(now)
+	return false
+}
+
+// 记一次丢弃，解析失败的消息也经由这里计数
+func (l *clientLimiter) drop(now time.Time) {
+	if now.Sub(l.windowStart) > l.window {
+		l.windowStart = now
+		l.windowDrops = 0
+	}
+	l.windowDrops++
+}
+
+// 当前窗口内丢弃过多，判定为刷屏
+func (l *clientLimiter) flooding() bool {
+	return l.kickAfter > 0 && l.windowDrops > l.kickAfter
+}
+
+// 令牌是否足够，不消耗
+func (b *tokenBucket) available(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	return b.tokens >= 1
+}
+
+// 每个 IP 的登录失败令牌桶，恢复满额后删除
+var (
+	loginFailures   = make(map[string]*tokenBucket)
+	loginFailuresMu sync.Mutex
+)
+
+// 该 IP 的登录失败次数已用完，应在校验密码前拒绝
+func loginBlocked(ip string, now time.Time) bool {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	b, ok := loginFailures[ip]
+	return ok && !b.available(now)
+}
+
+// 记录一次登录失败
+func recordLoginFailure(ip string, now time.Time) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	if len(loginFailures) > 1024 {
+		for k, b := range loginFailures {
+			if b.available(now) && b.tokens >= b.burst {
+				delete(loginFailures, k)
+			}
+		}
+	}
+	b, ok := loginFailures[ip]
+	if !ok {
+		b = newTokenBucket(model.Conf().RateLimit.LoginFailuresPerIP)
+		loginFailures[ip] = b
+	}
+	b.allow(now)
+}
+
+// 握手阶段单个连接的登录限速，只在该连接的握手中使用
+type loginLimiter struct {
+	attempts *tokenBucket
+	failures int
+	max      int
+}
+
+func newLoginLimiter() *loginLimiter {
+	cfg := model.Conf().RateLimit
+	return &loginLimiter{attempts: newTokenBucket(cfg.Login), max: cfg.MaxLoginFailures}
+}
+
+// 记一次失败，返回是否应断开连接
+func (l *loginLimiter) fail() bool {
+	l.failures++
+	return l.max > 0 && l.failures >= l.max
+}
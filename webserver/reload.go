@@ -0,0 +1,168 @@
+package webserver
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+)
+
+// 配置热加载的结果，字段名为 config.json 中的路径，如 game.reload_seconds
+type ReloadReport struct {
+	Source         string   `json:"source"`          // "file" 或 "admin"
+	Applied        []string `json:"applied"`         // 已立即生效
+	NewConnections []string `json:"new_connections"` // 已保存，只对之后建立的连接生效，已有连接保持原值
+	Deferred       []string `json:"deferred"`        // 已保存，生成或载入下一张地图时生效
+	Restart        []string `json:"restart"`         // 需要重启才能生效，运行中保持原值
+}
+
+// 建立连接（或首次出现某个 IP）时读取一次的配置
+var newConnectionSettings = []string{
+	"rate_limit.",
+	"heartbeat.ping_interval_seconds",
+}
+
+// 生成或载入地图时才读取的配置
+var deferredSettings = []string{
+	"game.map_size_x",
+	"game.map_size_y",
+	"map_gen.",
+}
+
+// 启动时读取一次的配置，热加载时忽略
+var restartSettings = []string{
+	"network.read_buffer_size",
+	"network.write_buffer_size",
+	"stats.db_path",
+	"stats.flush_seconds",
+	"auth.db_path",
+	"auth.secret",
+	"admin.bans_file",
+	"config_reload.poll_seconds",
+}
+
+var reloadMu sync.Mutex
+
+// 重新读取配置文件并应用，由 main 设置
+var ReloadConfigFile func() (ReloadReport, error)
+
+// 校验并原子替换配置，返回各字段的生效方式
+func ApplySettings(next model.Settings, source string) (ReloadReport, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	report := ReloadReport{Source: source, Applied: []string{}, NewConnections: []string{}, Deferred: []string{}, Restart: []string{}}
+	if err := errors.Join(next.Validate(), logging.Validate(next.Log)); err != nil {
+		return report, err
+	}
+
+	prev := *model.Conf()
+	for _, name := range diffSettings(reflect.ValueOf(prev), reflect.ValueOf(next), "") {
+		switch {
+		case matchSetting(name, restartSettings):
+			// 保留原值，避免运行中途换库或换签名密钥
+			copySetting(&next, &prev, name)
+			report.Restart = append(report.Restart, name)
+		case matchSetting(name, deferredSettings):
+			report.Deferred = append(report.Deferred, name)
+		case matchSetting(name, newConnectionSettings):
+			report.NewConnections = append(report.NewConnections, name)
+		default:
+			report.Applied = append(report.Applied, name)
+		}
+	}
+	model.SetConf(next)
+
+	if err := logging.Setup(next.Log); err != nil {
+		logging.Network.Error("apply log config", "err", err)
+	}
+	timing := false
+	if next.Game.TickIntervalMS != prev.Game.TickIntervalMS {
+		// 只有配置中的值变化时才覆盖管理接口临时设置的广播间隔
+		model.TickIntervalMS.Store(int64(next.Game.TickIntervalMS))
+		timing = true
+	}
+	if next.Game.MapRenderMS != prev.Game.MapRenderMS {
+		timing = true
+	}
+	if timing {
+		broadcastSettings()
+	}
+
+	logging.Network.Info("配置已更新", "source", source,
+		"applied", report.Applied, "new_connections", report.NewConnections,
+		"deferred", report.Deferred, "restart", report.Restart)
+	return report, nil
+}
+
+// 以 type=14 告知所有玩家与观战者新的时间参数
+func broadcastSettings() {
+	payload := model.SettingsPayload{
+		TickInterval: int(model.TickIntervalMS.Load()),
+		MapRenderMS:  model.Conf().Game.MapRenderMS,
+	}
+	data, err := RePackWebMessageJson(14, payload, "broadcast message gamer")
+	if err != nil {
+		logging.Network.Error("failed to marshal settings", "err", err)
+		return
+	}
+	broadcastToAllClients(data, "Broadcast settings")
+}
+
+func matchSetting(name string, list []string) bool {
+	for _, p := range list {
+		if name == p || (strings.HasSuffix(p, ".") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按 json 标签逐字段比较，返回值不同的字段路径
+func diffSettings(a, b reflect.Value, prefix string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{strings.TrimSuffix(prefix, ".")}
+	}
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		name := jsonName(a.Type().Field(i))
+		changed = append(changed, diffSettings(a.Field(i), b.Field(i), prefix+name+".")...)
+	}
+	return changed
+}
+
+// 把 src 中路径为 name 的字段复制到 dst
+func copySetting(dst, src *model.Settings, name string) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, part := range strings.Split(name, ".") {
+		i := fieldIndex(d.Type(), part)
+		if i < 0 {
+			return
+		}
+		d, s = d.Field(i), s.Field(i)
+	}
+	d.Set(s)
+}
+
+func fieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if jsonName(t.Field(i)) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
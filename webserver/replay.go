@@ -0,0 +1,326 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/replay"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	replayMinSpeed = 0.25
+	replayMaxSpeed = 16
+)
+
+// 回放播放状态，读循环修改，播放循环负责发送。回放文件按顺序逐帧读取，
+// 不整个载入内存；seek 时从头重新读到目标位置
+type replayPlayer struct {
+	client   *model.Client
+	name     string
+	header   *replay.Header
+	duration int64 // 最后一帧的时间（毫秒）
+
+	mu       sync.Mutex
+	rd       *replay.Reader
+	config   json.RawMessage // 当前位置之前最近的 type=1，resync 时发送
+	backlog  []replay.Frame  // seek 后立即补发的帧：最近的状态快照及其后到目标位置为止的消息
+	ahead    *replay.Frame   // 已读出、尚未到时间的下一帧，为 nil 表示已读完
+	playing  bool
+	speed    float64
+	position int64 // 当前播放位置（毫秒）
+	resync   bool  // seek 后需要先重发地形
+	notify   bool  // 需要发送 type=12
+}
+
+// 开始录制本局回放
+func startRecording(state model.MatchState) {
+	data, err := RePackWebMessageJson(1, spectatorMapConfig("replay"), "replay")
+	if err != nil {
+		logging.Game.Error("failed to marshal replay config", "err", err)
+		return
+	}
+	if err := replay.Start(state.Round, state.MapName, data); err != nil {
+		logging.Game.Warn("无法开始录制", "event", "replay", "round", state.Round, "err", err)
+	}
+}
+
+// GET /replays/{name}：以 websocket 播放回放，消息与观战端收到的相同
+func ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	// 封禁与 Origin 在读取回放文件之前检查
+	if rejectBannedIP(w, r) {
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	if !CheckOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	name := r.PathValue("name")
+	header, duration, frames, err := replay.Scan(name)
+	if err != nil {
+		if errors.Is(err, replay.ErrNotFound) {
+			http.Error(w, "replay not found", http.StatusNotFound)
+			return
+		}
+		logging.Network.Error("load replay error", "replay", name, "err", err)
+		http.Error(w, "replay unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := model.UP.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Network.Warn("upgrade error", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+
+	p := &replayPlayer{
+		client: &model.Client{
+			ID:         "replay-" + uuid.NewString()[:8],
+			Conn:       conn,
+			LastActive: time.Now(),
+		},
+		name:     name,
+		header:   header,
+		duration: duration,
+		playing:  true,
+		speed:    1,
+		notify:   true,
+	}
+	if err := p.seek(0); err != nil {
+		logging.Network.Error("load replay error", "replay", name, "err", err)
+		closeConn(p.client, websocket.CloseInternalServerErr, "replay unavailable")
+		return
+	}
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.close()
+	}()
+	if !trackConn(p.client) {
+		closeConn(p.client, websocket.CloseGoingAway, model.Conf().Shutdown.Notice)
+		return
+	}
+	defer untrackConn(p.client)
+	logging.Network.Info("playing replay", "event", "replay", "viewer", p.client.ID, "replay", name,
+		"frames", frames, "remote", r.RemoteAddr)
+
+	done := make(chan struct{})
+	extend := startHeartbeat(p.client, conn, done)
+	go p.playLoop(done)
+
+	defer func() {
+		close(done)
+		conn.Close()
+		logging.Network.Info("replay viewer left", "event", "leave", "viewer", p.client.ID)
+	}()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		extend()
+
+		_, _, payload, err := UnpackWebMessage(msg)
+		if err != nil {
+			continue
+		}
+		if rc, ok := payload.(model.ReplayControlPayload); ok {
+			if err := p.control(rc); err != nil {
+				p.sendNotice(err.Error())
+			}
+		}
+	}
+}
+
+func frameType(f replay.Frame) byte {
+	var m struct {
+		Type byte `json:"type"`
+	}
+	json.Unmarshal(f.Msg, &m)
+	return m.Type
+}
+
+// 处理播放控制
+func (p *replayPlayer) control(rc model.ReplayControlPayload) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch rc.Action {
+	case model.ReplayPlay:
+		if p.ahead == nil {
+			// 已播放完，从头开始
+			if err := p.seek(0); err != nil {
+				return err
+			}
+		}
+		p.playing = true
+	case model.ReplayPause:
+		p.playing = false
+	case model.ReplaySeek:
+		if err := p.seek(rc.At); err != nil {
+			return err
+		}
+	case model.ReplaySpeed:
+		if rc.Speed < replayMinSpeed || rc.Speed > replayMaxSpeed {
+			return errors.New("replay speed must be between 0.25 and 16")
+		}
+		p.speed = rc.Speed
+	default:
+		return errors.New("replay action must be play, pause, seek or speed")
+	}
+	p.notify = true
+	return nil
+}
+
+// 跳到指定位置：重新打开回放读到该位置，先重发之前最近的地形，
+// 再从之前最近的一帧状态快照开始发送；调用方持有 mu（启动时除外）
+func (p *replayPlayer) seek(at int64) error {
+	at = max(0, min(at, p.duration))
+	rd, err := replay.Open(p.name)
+	if err != nil {
+		logging.Network.Warn("reopen replay error", "replay", p.name, "err", err)
+		return errors.New("replay is no longer available")
+	}
+	p.close()
+	p.rd = rd
+	p.config = nil
+	p.backlog = p.backlog[:0]
+	p.ahead = nil
+	for {
+		fr, err := rd.Next()
+		if err != nil {
+			break
+		}
+		if fr.T > at && p.config != nil {
+			p.ahead = &fr
+			break
+		}
+		switch frameType(fr) {
+		case 1:
+			// 换图后之前的帧都不再需要
+			p.config = fr.Msg
+			p.backlog = p.backlog[:0]
+			continue
+		case 2:
+			p.backlog = p.backlog[:0]
+		}
+		p.backlog = append(p.backlog, fr)
+	}
+	p.position = at
+	p.resync = true
+	return nil
+}
+
+func (p *replayPlayer) read() {
+	fr, err := p.rd.Next()
+	if err != nil {
+		p.ahead = nil
+		return
+	}
+	p.ahead = &fr
+}
+
+func (p *replayPlayer) close() {
+	if p.rd != nil {
+		p.rd.Close()
+	}
+}
+
+// 按播放速度推进虚拟时钟并发送到期的帧
+func (p *replayPlayer) playLoop(done chan struct{}) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	last := time.Now()
+	lastStatus := last
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(last)
+			last = now
+
+			p.mu.Lock()
+			var out []json.RawMessage
+			if p.resync {
+				out = append(out, p.config)
+				for _, fr := range p.backlog {
+					out = append(out, fr.Msg)
+				}
+				p.backlog = p.backlog[:0]
+				p.resync = false
+			}
+			if p.playing {
+				p.position += int64(elapsed.Seconds() * 1000 * p.speed)
+				for p.ahead != nil && p.ahead.T <= p.position {
+					out = append(out, p.ahead.Msg)
+					p.read()
+				}
+				if p.ahead == nil {
+					p.playing = false
+					p.position = p.duration
+					p.notify = true
+				}
+			}
+			if p.playing && now.Sub(lastStatus) >= time.Second {
+				p.notify = true
+			}
+			var status *model.ReplayStatusPayload
+			if p.notify {
+				status = p.status()
+				p.notify = false
+				lastStatus = now
+			}
+			p.mu.Unlock()
+
+			for _, msg := range out {
+				if err := sendToClient(p.client, msg); err != nil {
+					return
+				}
+			}
+			if status != nil {
+				data, err := RePackWebMessageJson(12, status, p.client.ID)
+				if err != nil {
+					logging.Network.Error("failed to marshal replay status", "err", err)
+					continue
+				}
+				sendToClient(p.client, data)
+			}
+		}
+	}
+}
+
+// 调用方持有 mu
+func (p *replayPlayer) status() *model.ReplayStatusPayload {
+	return &model.ReplayStatusPayload{
+		Name:       p.name,
+		Round:      p.header.Round,
+		MapName:    p.header.MapName,
+		DurationMS: p.duration,
+		PositionMS: p.position,
+		Playing:    p.playing,
+		Speed:      p.speed,
+		Ended:      p.ahead == nil,
+	}
+}
+
+func (p *replayPlayer) sendNotice(notice string) {
+	data, err := RePackWebMessageJson(4, model.NoticePayload{Notice: notice}, p.client.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal notice", "err", err)
+		return
+	}
+	sendToClient(p.client, data)
+}
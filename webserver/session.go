@@ -0,0 +1,167 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"example.com/lite_demo/stats"
+	"github.com/gorilla/websocket"
+)
+
+// 连接断开后挂起会话，保留坦克、分数与用户名等待重连；返回 false 时由调用方释放客户端。
+// conn 是刚断开的连接，会话已被新连接接管时直接返回 true
+func suspendSession(client *model.Client, conn *websocket.Conn) bool {
+	grace := model.Conf().Session.GraceSeconds
+	model.ClientsMu.Lock()
+	defer model.ClientsMu.Unlock()
+
+	// 无论是否挂起都清空连接，claimSession 据此区分正在断开的会话
+	client.WriteMutex.Lock()
+	replaced := client.Conn != conn
+	if !replaced {
+		client.Conn = nil
+	}
+	client.WriteMutex.Unlock()
+	if replaced {
+		logging.Network.Debug("connection replaced by resume", "player", client.ID)
+		return true
+	}
+
+	tank := client.Tank
+	if grace <= 0 || tank == nil || client.Kicked {
+		return false
+	}
+
+	// 挂起期间坦克原地不动
+	tank.Orientation = model.DirNone
+	tank.Trigger = false
+
+	client.Suspended = true
+	client.GraceTimer = time.AfterFunc(time.Duration(grace)*time.Second, func() {
+		expireSession(client)
+	})
+
+	logging.Network.Info("session suspended", "event", "suspend", "player", client.ID, "grace_seconds", grace)
+	return true
+}
+
+// 重连超时，释放资源
+func expireSession(client *model.Client) {
+	model.ClientsMu.Lock()
+	if !client.Suspended {
+		// 已被重连接管
+		model.ClientsMu.Unlock()
+		return
+	}
+	client.Suspended = false
+	model.ClientsMu.Unlock()
+
+	logging.Network.Info("session expired", "event", "expire", "player", client.ID)
+	releaseClient(client)
+}
+
+// 校验重连令牌并把会话切换到 conn。会话仍在线时（旧连接半开，尚未等到 pong 超时）
+// 由新连接接管，旧连接随即关闭；正在断开或被踢出的会话不能接管
+func claimSession(username, token string, conn *websocket.Conn) bool {
+	model.ClientsMu.Lock()
+	c, ok := model.Clients[username]
+	if !ok || c.Kicked ||
+		subtle.ConstantTimeCompare([]byte(c.ResumeToken), []byte(token)) != 1 {
+		model.ClientsMu.Unlock()
+		return false
+	}
+	c.WriteMutex.Lock()
+	prev := c.Conn
+	if prev == nil && !c.Suspended {
+		c.WriteMutex.Unlock()
+		model.ClientsMu.Unlock()
+		return false
+	}
+	c.Conn = conn
+	c.WriteMutex.Unlock()
+	if c.Suspended {
+		c.Suspended = false
+		if c.GraceTimer != nil {
+			c.GraceTimer.Stop()
+		}
+	}
+	model.ClientsMu.Unlock()
+
+	if prev != nil {
+		// 旧连接的读循环随之退出，suspendSession 发现连接已被替换，不会释放会话
+		prev.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session resumed from another connection"),
+			time.Now().Add(time.Second))
+		prev.Close()
+		logging.Network.Info("session taken over", "event", "takeover", "player", username)
+	}
+	return true
+}
+
+// 在已切换到新连接的会话上重新发送 type=1 并开始读取消息
+func resumeSession(client *model.Client, username string) {
+	model.ClientsMu.Lock()
+	old := model.Clients[username]
+	model.ClientsMu.Unlock()
+
+	if old == nil {
+		logging.Network.Warn("session vanished before resume", "player", username)
+		client.Conn.Close()
+		return
+	}
+
+	model.ClientsMu.Lock()
+	old.RemoteAddr = client.RemoteAddr
+	old.LastActive = time.Now()
+	tank := old.Tank
+	model.ClientsMu.Unlock()
+
+	SendConfig(old)
+	if tank != nil {
+		logging.Network.Info("session resumed", "event", "resume", "player", username,
+			"x", tank.LocalX, "y", tank.LocalY, "point", tank.Point)
+	} else {
+		logging.Network.Info("session resumed", "event", "resume", "player", username)
+	}
+
+	go handleClientMessages(old)
+}
+
+// 以 type=4 告知原因后断开客户端，不保留会话
+func kickClient(client *model.Client, reason string) {
+	client.Kicked = true
+
+	notice := model.NoticePayload{Notice: reason}
+	data, err := RePackWebMessageJson(4, notice, client.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal notice", "err", err)
+	} else {
+		sendToClient(client, data)
+	}
+
+	closeConn(client, websocket.ClosePolicyViolation, reason)
+
+	logging.Network.Warn("kicked", "event", "kick", "player", client.ID, "reason", reason)
+}
+
+// 释放客户端占用的用户名与坦克
+func releaseClient(client *model.Client) {
+	model.ClientsMu.Lock()
+	delete(model.Clients, client.ID)
+	tank := client.Tank
+	client.Tank = nil
+	model.ClientsMu.Unlock()
+
+	removeUsername(client.ID)
+	if !client.Bot {
+		stats.RecordPlayTime(client.ID, time.Since(client.JoinedAt))
+	}
+
+	if tank != nil {
+		FreeTank(tank)
+	}
+
+	logging.Network.Info("client released", "event", "leave", "player", client.ID)
+}
@@ -0,0 +1,118 @@
+package webserver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/lite_demo/logging"
+	"example.com/lite_demo/model"
+	"github.com/gorilla/websocket"
+)
+
+// 正在关闭，不再接受新的玩家、观战与回放连接
+var shuttingDown atomic.Bool
+
+// 所有读循环中的连接（玩家、观战、回放），关闭时逐个通知并等待其清理完毕；
+// 重连接管时新旧两个读循环可能短暂共用一个客户端，因此按客户端计数
+var (
+	conns   = make(map[*model.Client]int)
+	connsMu sync.Mutex
+	connsWG sync.WaitGroup
+)
+
+// 登记连接，正在关闭时返回 false，调用方应直接断开
+func trackConn(c *model.Client) bool {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+	if shuttingDown.Load() {
+		return false
+	}
+	conns[c]++
+	connsWG.Add(1)
+	return true
+}
+
+func untrackConn(c *model.Client) {
+	connsMu.Lock()
+	if conns[c]--; conns[c] <= 0 {
+		delete(conns, c)
+	}
+	connsMu.Unlock()
+	connsWG.Done()
+}
+
+// 以指定关闭码发送关闭帧后断开连接
+func closeConn(c *model.Client, code int, reason string) {
+	c.WriteMutex.Lock()
+	defer c.WriteMutex.Unlock()
+	if c.Conn == nil {
+		return
+	}
+	c.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second))
+	c.Conn.Close()
+}
+
+// 优雅关闭：以 type=0 告知原因，用 1001 (going away) 关闭所有连接，
+// 释放挂起的会话，并等待各连接的清理（记录游戏时长等）完成或 ctx 超时
+func Shutdown(ctx context.Context) {
+	reason := model.Conf().Shutdown.Notice
+
+	connsMu.Lock()
+	shuttingDown.Store(true)
+	open := make([]*model.Client, 0, len(conns))
+	for c := range conns {
+		open = append(open, c)
+	}
+	connsMu.Unlock()
+
+	// 断开后不再挂起等待重连
+	model.ClientsMu.Lock()
+	var suspended []*model.Client
+	for _, c := range model.Clients {
+		if c.Bot {
+			continue
+		}
+		c.Kicked = true
+		if c.Suspended {
+			c.Suspended = false
+			if c.GraceTimer != nil {
+				c.GraceTimer.Stop()
+			}
+			suspended = append(suspended, c)
+		}
+	}
+	model.ClientsMu.Unlock()
+	for _, c := range suspended {
+		releaseClient(c)
+	}
+
+	logging.Network.Info("正在关闭，断开所有连接", "event", "shutdown", "connections", len(open), "reason", reason)
+	var wg sync.WaitGroup
+	for _, c := range open {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := RePackWebMessageJson(0, model.NoticePayload{Notice: reason}, c.ID)
+			if err == nil {
+				sendToClient(c, data)
+			}
+			closeConn(c, websocket.CloseGoingAway, reason)
+		}()
+	}
+	wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		connsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logging.Network.Warn("等待连接清理超时", "err", ctx.Err())
+	}
+}
@@ -0,0 +1,228 @@
+package webserver
+
+import (
+	"net/http"
+	"time"
+
+	"example.com/lite_demo/logging"
+	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/model"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// 处理观战连接：先发送一次完整地形，之后与玩家收到相同的广播
+func SpectatorHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectBannedIP(w, r) {
+		return
+	}
+	conn, err := model.UP.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Network.Warn("upgrade error", "remote", r.RemoteAddr, "err", err)
+		return
+	}
+
+	now := time.Now()
+	sizeX, sizeY := model.MapSize()
+	spec := &model.Client{
+		ID:         "spectator-" + uuid.NewString()[:8],
+		Conn:       conn,
+		LastActive: now,
+		JoinedAt:   now,
+		RemoteAddr: r.RemoteAddr,
+		Camera: &model.CameraPayload{
+			Mode: model.CameraFree,
+			X:    sizeX / 2,
+			Y:    sizeY / 2,
+		},
+	}
+
+	// 先加入列表再发地形，避免漏掉两者之间的广播
+	model.SpectatorsMu.Lock()
+	model.Spectators[spec.ID] = spec
+	model.SpectatorsMu.Unlock()
+
+	if err := sendSpectatorConfig(spec); err != nil {
+		logging.Network.Warn("failed to send config", "spectator", spec.ID, "err", err)
+		removeSpectator(spec)
+		conn.Close()
+		return
+	}
+	logging.Network.Info("new spectator", "event", "spectate", "spectator", spec.ID, "remote", r.RemoteAddr)
+
+	go handleSpectatorMessages(spec)
+}
+
+// 发送地形与当前状态
+func sendSpectatorConfig(spec *model.Client) error {
+	config := spectatorMapConfig(spec.ID)
+	config.Chat = recentChat()
+	data, err := RePackWebMessageJson(1, config, spec.ID)
+	if err != nil {
+		return err
+	}
+	return sendToClient(spec, data)
+}
+
+// 不含坦克坐标的完整地形，观战与回放共用
+func spectatorMapConfig(id string) model.MapConfig {
+	terrain, sizeX, sizeY := gamemap.GetMap()
+	return model.MapConfig{
+		Map:          terrain,
+		MapSizeX:     sizeX,
+		MapSizeY:     sizeY,
+		TickInterval: int(model.TickIntervalMS.Load()),
+		MapRenderMS:  model.Conf().Game.MapRenderMS,
+		ServerID:     id,
+		Tanks:        GetActiveTanks(),
+		Match:        CurrentMatch(),
+	}
+}
+
+// 观战消息循环，只接受镜头设置
+func handleSpectatorMessages(spec *model.Client) {
+	conn := spec.Conn
+	if !trackConn(spec) {
+		closeConn(spec, websocket.CloseGoingAway, model.Conf().Shutdown.Notice)
+		removeSpectator(spec)
+		return
+	}
+	defer untrackConn(spec)
+	done := make(chan struct{})
+	extend := startHeartbeat(spec, conn, done)
+	bucket := newTokenBucket(model.Conf().RateLimit.Move)
+	defer func() {
+		close(done)
+		conn.Close()
+		removeSpectator(spec)
+		logging.Network.Info("spectator left", "event", "leave", "spectator", spec.ID)
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		extend()
+		if !bucket.allow(time.Now()) {
+			spec.Dropped++
+			continue
+		}
+
+		_, _, payload, err := UnpackWebMessage(msg)
+		if err != nil {
+			continue
+		}
+		if sp, ok := payload.(model.SpectatePayload); ok {
+			setCamera(spec, sp)
+		}
+	}
+}
+
+func removeSpectator(spec *model.Client) {
+	model.SpectatorsMu.Lock()
+	delete(model.Spectators, spec.ID)
+	model.SpectatorsMu.Unlock()
+}
+
+// 切换镜头：follow 跟随指定玩家，free 由观战端自行移动
+func setCamera(spec *model.Client, sp model.SpectatePayload) {
+	var notice string
+	switch sp.Mode {
+	case model.CameraFollow:
+		if findActiveTank(sp.Target) == nil {
+			notice = "player " + sp.Target + " is not in game"
+			break
+		}
+		model.SpectatorsMu.Lock()
+		spec.Camera.Mode = model.CameraFollow
+		spec.Camera.Target = sp.Target
+		model.SpectatorsMu.Unlock()
+	case model.CameraFree:
+		sizeX, sizeY := model.MapSize()
+		model.SpectatorsMu.Lock()
+		spec.Camera.Mode = model.CameraFree
+		spec.Camera.Target = ""
+		spec.Camera.X = min(sp.X, sizeX-1)
+		spec.Camera.Y = min(sp.Y, sizeY-1)
+		camera := *spec.Camera
+		model.SpectatorsMu.Unlock()
+		sendCamera(spec, &camera)
+	default:
+		notice = "camera mode must be follow or free"
+	}
+
+	if notice == "" {
+		return
+	}
+	data, err := RePackWebMessageJson(4, model.NoticePayload{Notice: notice}, spec.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal notice", "err", err)
+		return
+	}
+	sendToClient(spec, data)
+}
+
+func findActiveTank(username string) *model.Tank {
+	for _, t := range GetActiveTanks() {
+		if t.ID == username {
+			return t
+		}
+	}
+	return nil
+}
+
+// 广播给所有观战者
+func broadcastToSpectators(data []byte, logPrefix string) {
+	model.SpectatorsMu.Lock()
+	defer model.SpectatorsMu.Unlock()
+	for _, s := range model.Spectators {
+		if err := sendToClient(s, data); err != nil {
+			logging.Network.Warn(logPrefix+" error", "spectator", s.ID, "err", err)
+		}
+	}
+}
+
+// 每次状态广播后，更新跟随模式观战者的镜头位置
+func updateSpectatorCameras(tanks []*model.Tank) {
+	model.SpectatorsMu.Lock()
+	defer model.SpectatorsMu.Unlock()
+	for _, s := range model.Spectators {
+		if s.Camera.Mode != model.CameraFollow {
+			continue
+		}
+		for _, t := range tanks {
+			if t.ID == s.Camera.Target {
+				s.Camera.X, s.Camera.Y = t.LocalX, t.LocalY
+				camera := *s.Camera
+				sendCamera(s, &camera)
+				break
+			}
+		}
+	}
+}
+
+func sendCamera(spec *model.Client, camera *model.CameraPayload) {
+	data, err := RePackWebMessageJson(11, camera, spec.ID)
+	if err != nil {
+		logging.Network.Error("failed to marshal camera", "err", err)
+		return
+	}
+	sendToClient(spec, data)
+}
+
+// 换图后给观战者重发地形
+func resendSpectatorConfig() {
+	model.SpectatorsMu.Lock()
+	specs := make([]*model.Client, 0, len(model.Spectators))
+	for _, s := range model.Spectators {
+		specs = append(specs, s)
+	}
+	model.SpectatorsMu.Unlock()
+
+	for _, s := range specs {
+		if err := sendSpectatorConfig(s); err != nil {
+			logging.Network.Warn("failed to send config", "spectator", s.ID, "err", err)
+		}
+	}
+}
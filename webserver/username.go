@@ -0,0 +1,79 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"example.com/lite_demo/model"
+)
+
+var (
+	errUsernameEmpty  = errors.New("username is empty")
+	errUsernameExists = errors.New("username already exists")
+)
+
+// 按配置检查用户名，返回具体违反的规则
+func validateUsername(username string) error {
+	cfg := model.Conf().Username
+	if username == "" {
+		return errUsernameEmpty
+	}
+
+	n := len([]rune(username))
+	if cfg.MinLength > 0 && n < cfg.MinLength {
+		return fmt.Errorf("username must be at least %d characters", cfg.MinLength)
+	}
+	if cfg.MaxLength > 0 && n > cfg.MaxLength {
+		return fmt.Errorf("username must be at most %d characters", cfg.MaxLength)
+	}
+	if strings.TrimSpace(username) != username {
+		return errors.New("username must not start or end with spaces")
+	}
+
+	for _, r := range username {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return errors.New("username contains control or invalid characters")
+		}
+		if !runeAllowed(r, cfg.AllowedClasses) {
+			return fmt.Errorf("username contains %q, allowed characters are: %s",
+				r, strings.Join(cfg.AllowedClasses, ", "))
+		}
+	}
+
+	normalized := model.NormalizeUsername(username)
+	for _, word := range cfg.Reserved {
+		if normalized == model.NormalizeUsername(word) {
+			return fmt.Errorf("username %q is reserved", username)
+		}
+	}
+	return nil
+}
+
+func runeAllowed(r rune, classes []string) bool {
+	if len(classes) == 0 {
+		return true
+	}
+	for _, name := range classes {
+		if is, ok := model.UsernameClasses[name]; ok && is(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// 查重并占用用户名，规范化后相同的名字视为重复
+func reserveUsername(username string) error {
+	model.UsernameMu.Lock()
+	defer model.UsernameMu.Unlock()
+
+	normalized := model.NormalizeUsername(username)
+	for _, u := range model.Usernames {
+		if u != "" && model.NormalizeUsername(u) == normalized {
+			return errUsernameExists
+		}
+	}
+	model.Usernames = append(model.Usernames, username)
+	return nil
+}
@@ -1,23 +1,34 @@
 package webserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"example.com/lite_demo/auth"
+	"example.com/lite_demo/logging"
 	gamemap "example.com/lite_demo/map"
+	"example.com/lite_demo/metrics"
 	"example.com/lite_demo/model"
+	"example.com/lite_demo/replay"
+	"example.com/lite_demo/stats"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // 处理链接请求
 func Handler(w http.ResponseWriter, r *http.Request) {
+	if rejectBannedIP(w, r) {
+		return
+	}
 	// 1. 升级 HTTP 连接为 WebSocket
 	conn, err := model.UP.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		logging.Network.Warn("upgrade error", "remote", r.RemoteAddr, "err", err)
 		return
 	}
 
@@ -25,30 +36,38 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	client := &model.Client{
 		Conn:       conn,
 		LastActive: time.Now(),
+		RemoteAddr: r.RemoteAddr,
 	}
 
 	// 3. 发送连接成功通知
 	if err := sendConnectNotice(client); err != nil {
-		log.Println("Failed to marshal notice payload:", err)
+		logging.Network.Warn("发送连接通知失败", "remote", r.RemoteAddr, "err", err)
 		return
 	}
 
 	// 4. 等待客户端提交用户名
 	ok, username := waitForUsername(client)
 	if !ok {
-		log.Println("⏳ 超时或失败，未获取 username")
+		logging.Network.Info("超时或失败，未获取 username", "remote", r.RemoteAddr)
 		conn.Close() // 关闭连接，释放资源
 		return
 	}
-	log.Println("✅ 成功获取 username:", username)
+	logging.Network.Debug("成功获取 username", "player", username, "remote", r.RemoteAddr)
+	if client.ResumeToken != "" {
+		// 断线重连，接回原有坦克与分数
+		resumeSession(client, username)
+		return
+	}
 	client.ID = username
+	client.ResumeToken = uuid.NewString()
+	client.JoinedAt = time.Now()
 	model.ClientsMu.Lock()
 	model.Clients[username] = client
 	model.ClientsMu.Unlock()
 	// 5. 为客户端分配坦克
 	tank := allocateTank(username)
 	if tank == nil {
-		log.Printf("❌ No available spawn point for %s\n", username)
+		logging.Game.Warn("no available spawn point", "player", username)
 		sendNoSpawnNotice(client, username)
 		conn.Close()
 		removeUsername(username)
@@ -57,13 +76,15 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 
 	// 6. 添加客户端到全局列表
 
+	model.ClientsMu.Lock()
 	client.Tank = tank
+	model.ClientsMu.Unlock()
 
 	// 7. 发送配置信息
 	SendConfig(client)
 
-	log.Printf("🎮 New connection: %s at (%d,%d) facing %d\n",
-		username, tank.LocalX, tank.LocalY, tank.Orientation)
+	logging.Game.Info("new connection", "event", "join", "player", username,
+		"x", tank.LocalX, "y", tank.LocalY, "facing", tank.Orientation, "remote", r.RemoteAddr)
 
 	// 8. 启动消息读取 goroutine
 	go handleClientMessages(client)
@@ -80,59 +101,78 @@ func sendConnectNotice(client *model.Client) error {
 		return err
 	}
 
-	client.WriteMutex.Lock()
-	defer client.WriteMutex.Unlock()
-	err = client.Conn.WriteMessage(websocket.TextMessage, data)
-
-	return err
+	return sendToClient(client, data)
 }
 
 // 发送无可用出生点通知
 func sendNoSpawnNotice(client *model.Client, username string) {
 	data, err := RePackWebMessageJson(4, []byte("No available spawn point"), username)
 	if err != nil {
-		log.Println("Failed to marshal game state:", err)
+		logging.Network.Error("failed to marshal notice", "err", err)
 		return
 	}
 
-	client.WriteMutex.Lock()
-	client.Conn.WriteMessage(websocket.TextMessage, data)
-	client.WriteMutex.Unlock()
-
+	sendToClient(client, data)
 }
 
 // 处理客户端消息循环
 func handleClientMessages(client *model.Client) {
+	conn := client.Conn
+	if !trackConn(client) {
+		client.Kicked = true
+		closeConn(client, websocket.CloseGoingAway, model.Conf().Shutdown.Notice)
+		releaseClient(client)
+		return
+	}
+	defer untrackConn(client)
+	done := make(chan struct{})
+	extend := startHeartbeat(client, conn, done)
+	limiter := newClientLimiter()
 	defer func() {
-		log.Printf("free resource")
-		client.Conn.Close()
-
-		model.ClientsMu.Lock()
-		delete(model.Clients, client.ID)
-		model.ClientsMu.Unlock()
-
-		removeUsername(client.ID)
+		logging.Network.Debug("free resource", "player", client.ID)
+		close(done)
+		conn.Close()
 
-		if client.Tank != nil {
-			FreeTank(client.Tank)
-			log.Printf("✅ Freed spawn for %s\n", client.ID)
+		// 保留坦克等待重连，超时后再释放
+		if suspendSession(client, conn) {
+			return
 		}
-
-		log.Printf("🔌 Connection %s closed\n", client.ID)
+		releaseClient(client)
 	}()
 
 	for {
 		// 读取客户端消息
-		_, msg, err := client.Conn.ReadMessage()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("⚠️ Connection %s error: %v\n", client.ID, err)
+			logging.Network.Info("connection closed", "player", client.ID, "err", err)
 			break
 		}
+		extend()
+
+		// 限速，超出的消息直接丢弃，持续刷屏则断开；在解析之前计数，
+		// 无法解析与游戏中不接受的消息同样算作丢弃
+		now := time.Now()
+		if !limiter.allowFrame(now) {
+			if dropMessage(client, limiter, "rate limiting", nil) {
+				break
+			}
+			continue
+		}
 
 		// 解析客户端发送的 JSON 消消息
 		_, _, payload, err := UnpackWebMessage(msg)
 		if err != nil {
-			log.Printf("❌ Failed to parse JSON from %s: %v", client.ID, err)
+			limiter.drop(now)
+			if dropMessage(client, limiter, "failed to parse message", err) {
+				break
+			}
+			continue
+		}
+
+		if !limiter.allow(payload, now) {
+			if dropMessage(client, limiter, "rate limiting", nil) {
+				break
+			}
 			continue
 		}
 
@@ -140,89 +180,157 @@ func handleClientMessages(client *model.Client) {
 		case model.OperatePayload:
 			processOperatePayload(client, v)
 		case model.HitPayload:
+			// 只接受以自己为射手的命中通知，机器人直接调用 processHitPayload 不经过这里
+			if v.Username != client.ID {
+				limiter.drop(now)
+				if dropMessage(client, limiter, "hit reported for another shooter", fmt.Errorf("username %q", v.Username)) {
+					return
+				}
+				continue
+			}
 			processHitPayload(v)
 		case model.RespawnPayload:
-			processRespawnPayload(v)
+			if currentTank(client) == nil {
+				// 观战中的玩家重新加入
+				rejoinFromSpectator(client)
+			} else {
+				processRespawnPayload(v)
+			}
+		case model.ChatPayload:
+			handleChat(client, v)
 		default:
-			log.Printf("⚠️ payload 不是 OperatePayload/HitPayload，而是：%T", payload)
+			limiter.drop(now)
+			if dropMessage(client, limiter, "unexpected payload", fmt.Errorf("%T", payload)) {
+				return
+			}
 		}
 	}
 }
 
-// 处理坦克操作指令
-func processOperatePayload(client *model.Client, op model.OperatePayload) {
+// 统计一条被丢弃的消息，每个窗口只在第一次丢弃时记录日志，避免刷屏刷日志；返回是否已断开
+func dropMessage(client *model.Client, limiter *clientLimiter, reason string, err error) bool {
+	client.Dropped++
+	if limiter.windowDrops == 1 {
+		logging.Network.Warn(reason, "player", client.ID, "dropped", client.Dropped, "err", err)
+	}
+	if limiter.flooding() {
+		kickClient(client, "too many messages, disconnected for flooding")
+		return true
+	}
+	return false
+}
+
+// 处理坦克操作指令，开火时返回射击事件
+func processOperatePayload(client *model.Client, op model.OperatePayload) *model.ShotEvent {
 	moveDir := parseDirection(op.Up, op.Down, op.Left, op.Right)
+	// 挂机检测、转观战与换图都在 ClientsMu 下读写，这里只取一次坦克指针
+	model.ClientsMu.Lock()
 	client.LastActive = time.Now()
-	client.Tank.Orientation = moveDir
+	tank := client.Tank
+	if tank != nil {
+		tank.AFK = false
+	}
+	model.ClientsMu.Unlock()
+	if tank == nil {
+		return nil
+	}
+	tank.Orientation = moveDir
 
 	if moveDir != model.DirNone {
-		client.Tank.GunFacing = moveDir
+		tank.GunFacing = moveDir
 	}
-	log.Printf(ColorGreen+"[move event]"+ColorReset+" tank %s move to (%d,%d) facing %d",
-		client.ID, client.Tank.LocalX, client.Tank.LocalY, client.Tank.Orientation)
+	logging.Game.Debug("move", "event", "move", "player", client.ID,
+		"x", tank.LocalX, "y", tank.LocalY, "facing", tank.Orientation)
 	// 检查是否开火
-	if op.Action == "fire" && client.Tank.Reload == 0 {
-		se := OpenFire(client.Tank)
-		log.Printf(ColorBlue+"[shot event]"+ColorReset+" tank %s fires (reload OK)", client.ID)
+	if op.Action == "fire" && tank.Reload == 0 && matchAllowsPlay() {
+		se := OpenFire(tank)
+		logging.Game.Debug("fire", "event", "shot", "player", client.ID, "x", se.LocalX, "y", se.LocalY)
+		if matchIsLive() && !client.Bot {
+			stats.RecordShot(client.ID)
+		}
 		data, err := RePackWebMessageJson(3, se, "broadcast message gamer")
 		if err != nil {
-			log.Println("Failed to marshal game state:", err)
-			return
+			logging.Game.Error("failed to marshal shot event", "err", err)
+			return se
 		}
 		broadcastToAllClients(data, "Broadcast fire")
+		return se
 	}
+	return nil
 }
 
 // 处理命中事件
 func processHitPayload(oh model.HitPayload) {
+	if !matchAllowsPlay() {
+		return
+	}
 	model.ClientsMu.Lock()
 
-	var victimClient *model.Client
+	var victimClient, shooterClient *model.Client
+	var victimTank *model.Tank
 	for _, c := range model.Clients {
-		if c.Tank != nil && c.Tank.ID == oh.Victim {
+		if c.Tank == nil {
+			continue
+		}
+		if c.Tank.ID == oh.Victim {
 			victimClient = c
-			break
-		} else if c.Tank != nil && c.Tank.ID == oh.Username {
-			c.Tank.Point += 1
+			victimTank = c.Tank
+		} else if c.Tank.ID == oh.Username {
+			shooterClient = c
+		}
+	}
+	shooterPoint := 0
+	if victimClient != nil && shooterClient != nil {
+		shooterClient.Tank.Point += 1
+		shooterPoint = shooterClient.Tank.Point
+
+		kill := victimTank.Status == model.StatusTaken
+		metrics.Hit(kill)
+		if matchIsLive() {
+			if !shooterClient.Bot {
+				stats.RecordHit(shooterClient.ID, kill)
+			}
+			if kill && !victimClient.Bot {
+				stats.RecordDeath(victimClient.ID)
+			}
 		}
 	}
 	model.ClientsMu.Unlock()
 	if victimClient == nil {
-		log.Printf("⚠️ Victim tank %s not found among clients, hit by %s", oh.Victim, oh.Username)
+		logging.Game.Warn("victim not found", "event", "hit", "player", oh.Username, "victim", oh.Victim)
 		return
 	}
 
 	// 释放并重新分配坦克
 
-	victimClient.Tank.Status = model.StatusFree
+	victimTank.Status = model.StatusFree
 	tankchange := model.TankChangePayload{
 		Username: victimClient.ID,
 		TurnTo:   false,
-		X:        victimClient.Tank.LocalX,
-		Y:        victimClient.Tank.LocalY,
+		X:        victimTank.LocalX,
+		Y:        victimTank.LocalY,
 	}
 	data, err := RePackWebMessageJson(5, tankchange, "")
 	if err != nil {
-		log.Println("Failed to marshal game state:", err)
+		logging.Game.Error("failed to marshal tank change", "err", err)
 	}
 	broadcastToAllClients(data, "Broadcast change")
 
 	// 只有存在被击中人时才广播
 	data, err = RePackWebMessageJson(7, oh, "broadcast message gamer")
 	if err != nil {
-		log.Println("Failed to marshal game state:", err)
+		logging.Game.Error("failed to marshal hit", "err", err)
 		return
 	}
 
-	log.Printf(ColorRed+"[hit event]"+ColorReset+" tank %s hit by %s", oh.Victim, oh.Username)
+	logging.Game.Info("hit", "event", "hit", "player", oh.Username, "victim", oh.Victim)
 	broadcastToAllClients(data, "Broadcast victim")
+
+	checkScoreLimit(shooterPoint)
 }
 
 func processRespawnPayload(p model.RespawnPayload) {
-	log.Printf("[respawn event] 开始处理用户 %s 请求重生", p.Username)
-
 	model.ClientsMu.Lock()
-	log.Printf("[respawn event] 已获取 ClientsMu 锁")
 
 	var targetClient *model.Client
 	for _, c := range model.Clients {
@@ -234,37 +342,40 @@ func processRespawnPayload(p model.RespawnPayload) {
 
 	// 找到目标客户端后，释放 ClientsMu 锁
 	model.ClientsMu.Unlock()
-	log.Printf("[respawn event] 释放 ClientsMu 锁")
 
 	if targetClient == nil {
-		log.Printf("[respawn event] 未找到用户 %s", p.Username)
+		logging.Game.Warn("respawn target not found", "event", "respawn", "player", p.Username)
 		return
 	}
 
 	// 调用 allocateTank 函数，此时无锁冲突
 	newTank := allocateTank(p.Username)
 	if newTank == nil {
-		log.Printf("[respawn event] allocateTank 失败，无法为 %s 分配新坦克", p.Username)
+		logging.Game.Warn("allocateTank 失败，无法分配新坦克", "event", "respawn", "player", p.Username)
 		return
 	}
 
-	// 重新获取 ClientsMu 锁以更新客户端信息
+	// 重新获取 ClientsMu 锁以更新客户端信息，旧坦克在释放锁之后再收回
 	model.ClientsMu.Lock()
-	log.Printf("[respawn event] 重新获取 ClientsMu 锁")
-	defer func() {
-		log.Printf("[respawn event] 释放 ClientsMu 锁")
-		model.ClientsMu.Unlock()
-	}()
-
-	// 确保目标客户端仍然有效
-	if targetClient.Tank != nil && targetClient.Tank.ID == p.Username {
-		newTank.Point = targetClient.Tank.Point
-		FreeTank(targetClient.Tank)
+	old := targetClient.Tank
+	valid := old != nil && old.ID == p.Username
+	if valid {
+		newTank.Point = old.Point
+		newTank.Bot = targetClient.Bot
 		targetClient.Tank = newTank
-	} else {
-		log.Printf("[respawn event] 处理过程中用户 %s 已断开连接", p.Username)
 	}
+	model.ClientsMu.Unlock()
 
+	// 确保目标客户端仍然有效
+	if !valid {
+		logging.Game.Info("处理过程中用户已断开连接", "event", "respawn", "player", p.Username)
+		FreeTank(newTank)
+		return
+	}
+	FreeTank(old)
+	metrics.Respawn()
+	logging.Game.Debug("respawn", "event", "respawn", "player", p.Username,
+		"x", newTank.LocalX, "y", newTank.LocalY)
 }
 
 // 广播消息到所有客户端
@@ -272,81 +383,106 @@ func broadcastToAllClients(data []byte, logPrefix string) {
 	model.ClientsMu.Lock()
 	defer model.ClientsMu.Unlock()
 	for _, c := range model.Clients {
-
-		c.WriteMutex.Lock()
-		err := c.Conn.WriteMessage(websocket.TextMessage, data)
-		c.WriteMutex.Unlock()
-
-		if err != nil {
-			log.Printf("%s Error sending to %s: %v\n", logPrefix, c.ID, err)
+		if err := sendToClient(c, data); err != nil {
+			logging.Network.Warn(logPrefix+" error", "player", c.ID, "err", err)
 		}
 	}
+	broadcastToSpectators(data, logPrefix)
+	replay.Record(data)
 }
 
-// 广播地图
-func BroadcastLoop() {
-	ticker := time.NewTicker(model.TICK_INTERVAL_MS * time.Millisecond)
+// 广播地图，ctx 取消时退出
+func BroadcastLoop(ctx context.Context) {
+	interval := model.TickIntervalMS.Load()
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		BroadcastGameState()
+		// 管理接口或配置热加载修改了广播间隔
+		if v := model.TickIntervalMS.Load(); v != interval {
+			interval = v
+			ticker.Reset(time.Duration(interval) * time.Millisecond)
+		}
 	}
 }
 
 // 广播地图状态
 func BroadcastGameState() {
+	defer metrics.ObserveTick(metrics.LoopBroadcast, time.Now())
 	state := BuildGameState()
 	data, err := RePackWebMessageJson(2, state, "broadcast message gamer")
 	if err != nil {
-		log.Println("Failed to marshal game state:", err)
+		logging.Game.Error("failed to marshal game state", "err", err)
 		return
 	}
 	model.ClientsMu.Lock()
-	defer model.ClientsMu.Unlock()
 	for _, c := range model.Clients {
-
-		c.WriteMutex.Lock()
-		err := c.Conn.WriteMessage(websocket.TextMessage, data)
-		c.WriteMutex.Unlock()
-
-		if err != nil {
-			log.Printf("Broadcast map Error sending to %s: %v\n", c.ID, err)
+		if err := sendToClient(c, data); err != nil {
+			logging.Network.Warn("broadcast state error", "player", c.ID, "err", err)
 		}
 	}
+	model.ClientsMu.Unlock()
+
+	broadcastToSpectators(data, "Broadcast map")
+	replay.Record(data)
+	updateSpectatorCameras(state.Tanks)
 }
 
-// 链接建立时 发送所需数据
+// 链接建立时 发送所需数据；观战中没有坦克时坐标为零
 func SendConfig(c *model.Client) {
-
+	terrain, sizeX, sizeY := gamemap.GetMap()
+	var tank model.Tank
+	if t := currentTank(c); t != nil {
+		tank = *t
+	}
 	config := model.MapConfig{
-		Map:          gamemap.GetMap(),
-		MapSizeX:     model.MAP_SIZE_X,
-		MapSizeY:     model.MAP_SIZE_Y,
-		TickInterval: model.TICK_INTERVAL_MS,
-		MapRenderMS:  model.MAP_RENDER_MS,
-		TankCoordX:   c.Tank.LocalX,
-		TankCoordY:   c.Tank.LocalY,
-		Tankfacing:   c.Tank.GunFacing,
+		Map:          terrain,
+		MapSizeX:     sizeX,
+		MapSizeY:     sizeY,
+		TickInterval: int(model.TickIntervalMS.Load()),
+		MapRenderMS:  model.Conf().Game.MapRenderMS,
+		TankCoordX:   tank.LocalX,
+		TankCoordY:   tank.LocalY,
+		Tankfacing:   tank.GunFacing,
 		ServerID:     c.ID,
 		Tanks:        GetActiveTanks(),
+		Match:        CurrentMatch(),
+		ResumeToken:  c.ResumeToken,
+		Chat:         recentChat(),
 	}
 
 	data, err := RePackWebMessageJson(1, config, c.ID)
 	if err != nil {
-		log.Println("Failed to marshal game state:", err)
+		logging.Network.Error("failed to marshal map config", "err", err)
 		return
 	}
 
-	c.WriteMutex.Lock()
-	err = c.Conn.WriteMessage(websocket.TextMessage, data)
-	c.WriteMutex.Unlock()
-
-	if err != nil {
-		log.Println("write message error:", err)
+	if err := sendToClient(c, data); err != nil {
+		logging.Network.Warn("send map config error", "player", c.ID, "err", err)
 		return
 	}
 }
 
+// 向单个客户端发送消息（会话挂起期间连接为空，直接丢弃）
+func sendToClient(c *model.Client, data []byte) error {
+	c.WriteMutex.Lock()
+	defer c.WriteMutex.Unlock()
+	if c.Conn == nil {
+		return nil
+	}
+	if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	metrics.Sent(data)
+	return nil
+}
+
 // 打包为webmessage
 func RePackWebMessageJson(msgType byte, payload interface{}, id string) ([]byte, error) {
 	mes := model.WebMessage{
@@ -363,8 +499,11 @@ func UnpackWebMessage(data []byte) (byte, string, interface{}, error) {
 	var mes model.WebMessage
 	err := json.Unmarshal(data, &mes)
 	if err != nil {
+		metrics.Received(0, len(data), false)
 		return 0, "", nil, err
 	}
+	// 所有收到的客户端消息都经过这里解包，在此统计
+	metrics.Received(mes.Type, len(data), true)
 	//log.Printf("%+v", mes)
 	// 因为 Payload 是 interface{}，它现在是 map[string]interface{}
 	// 所以我们先把它再 Marshal 一次，得到原始 JSON
@@ -402,6 +541,30 @@ func UnpackWebMessage(data []byte) (byte, string, interface{}, error) {
 			return 0, "", nil, err
 		}
 		payload = rp
+	case 19:
+		var lp model.LoginPayload
+		if err := json.Unmarshal(payloadBytes, &lp); err != nil {
+			return 0, "", nil, err
+		}
+		payload = lp
+	case 20:
+		var sp model.SpectatePayload
+		if err := json.Unmarshal(payloadBytes, &sp); err != nil {
+			return 0, "", nil, err
+		}
+		payload = sp
+	case 21:
+		var rp model.ReplayControlPayload
+		if err := json.Unmarshal(payloadBytes, &rp); err != nil {
+			return 0, "", nil, err
+		}
+		payload = rp
+	case 22:
+		var cp model.ChatPayload
+		if err := json.Unmarshal(payloadBytes, &cp); err != nil {
+			return 0, "", nil, err
+		}
+		payload = cp
 	default:
 		return 0, "", nil, fmt.Errorf("unknown message type: %d", mes.Type)
 	}
@@ -411,21 +574,27 @@ func UnpackWebMessage(data []byte) (byte, string, interface{}, error) {
 
 // 等待客户端注册用户名
 func waitForUsername(c *model.Client) (bool, string) {
-	c.Conn.SetReadDeadline(time.Now().Add(model.WAIT_REPLY_TIME * time.Second))
+	c.Conn.SetReadDeadline(time.Now().Add(time.Duration(model.Conf().Network.HandshakeTimeoutSeconds) * time.Second))
 	msgCh := make(chan []byte)
 	timeoutCh := make(chan bool)
+	limiter := newLoginLimiter()
 	closeCh := make(chan bool)
 
 	// 读取消息的 goroutine
 	go func() {
-		log.Println("[goroutine] 启动")
-		defer log.Println("[goroutine] 退出")
+		logging.Network.Debug("[goroutine] 启动")
+		defer logging.Network.Debug("[goroutine] 退出")
 
 		for {
 			// log.Println("[goroutine] 开始 ReadMessage")
 			_, msg, err := c.Conn.ReadMessage()
 			if err != nil {
 				// log.Println("[goroutine] ReadMessage 出错:", err)
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					metrics.HandshakeFailed(metrics.HandshakeTimeout)
+				} else {
+					metrics.HandshakeFailed(metrics.HandshakeClosed)
+				}
 
 				// log.Println("[goroutine] 尝试写入 timeoutCh")
 				timeoutCh <- true
@@ -471,7 +640,11 @@ func waitForUsername(c *model.Client) (bool, string) {
 
 		case msg := <-msgCh:
 			// log.Println("[WaitForCondition] 从 msgCh 收到:", string(msg))
-			readNext, username, err := handleRegisterMessage(c, msg)
+			readNext, username, err := handleRegisterMessage(c, msg, limiter)
+			if errors.Is(err, errTooManyLogins) {
+				closeCh <- true
+				return false, err.Error()
+			}
 			// log.Println("[WaitForCondition] processMessage 返回:", readNext, username, err)
 
 			// log.Println("[WaitForCondition] 尝试写入 closeCh:", readNext)
@@ -491,39 +664,114 @@ func waitForUsername(c *model.Client) (bool, string) {
 	}
 }
 
+var errTooManyLogins = errors.New("too many failed logins")
+
 // 处理注册消息
-func handleRegisterMessage(c *model.Client, msg []byte) (bool, string, error) {
+func handleRegisterMessage(c *model.Client, msg []byte, limiter *loginLimiter) (bool, string, error) {
 	_, _, payload, err := UnpackWebMessage(msg)
 	if err != nil {
 		return false, "", fmt.Errorf("failed to parse message: %w", err)
 	}
 
-	rp, ok := payload.(model.RequestPayload)
-	if !ok {
-		log.Printf("payload 不是 RequestPayload，而是：%T", payload)
+	if lp, ok := payload.(model.LoginPayload); ok {
+		if !handleLoginMessage(c, lp, limiter) && limiter.fail() {
+			logging.Network.Warn("too many failed logins, disconnecting", "event", "login",
+				"player", lp.Username, "remote", c.RemoteAddr, "failures", limiter.failures)
+			closeConn(c, websocket.ClosePolicyViolation, errTooManyLogins.Error())
+			return false, "", errTooManyLogins
+		}
 		return false, "", nil
 	}
 
-	if rp.Success && isUsernameLegal(rp.Username) {
-		model.UsernameMu.Lock()
-		model.Usernames = append(model.Usernames, rp.Username)
-		model.UsernameMu.Unlock()
-		return true, rp.Username, nil
+	rp, ok := payload.(model.RequestPayload)
+	if !ok {
+		logging.Network.Warn("payload 不是 RequestPayload", "payload", fmt.Sprintf("%T", payload))
+		return false, "", nil
 	}
 
 	notice := model.NoticePayload{
 		Notice: "username is empty or already exists",
 	}
+	if ban := findBan(rp.Username, remoteIP(c.RemoteAddr)); ban != nil {
+		notice.Notice = ban.notice()
+	} else if rp.ResumeToken != "" {
+		if claimSession(rp.Username, rp.ResumeToken, c.Conn) {
+			c.ResumeToken = rp.ResumeToken
+			return true, rp.Username, nil
+		}
+		notice.Notice = "session expired or resume token is invalid"
+	} else if rp.Success {
+		err := validateUsername(rp.Username)
+		if err == nil {
+			err = auth.Authorize(rp.Username, rp.Token)
+		}
+		if err == nil {
+			err = validateTeam(rp.Team)
+		}
+		if err == nil {
+			err = reserveUsername(rp.Username)
+		}
+		if err == nil {
+			c.Team = rp.Team
+			return true, rp.Username, nil
+		}
+		notice.Notice = err.Error()
+	}
 
+	metrics.HandshakeFailed(metrics.HandshakeRejected)
+	logging.Network.Info("registration rejected", "player", rp.Username, "reason", notice.Notice)
 	data, err := RePackWebMessageJson(4, notice, rp.Username)
 	if err != nil {
-		log.Println("Failed to marshal notice payload:", err)
+		logging.Network.Error("failed to marshal notice", "err", err)
 		return false, "", nil
 	}
 
-	c.WriteMutex.Lock()
-	c.Conn.WriteMessage(websocket.TextMessage, data)
-	c.WriteMutex.Unlock()
+	sendToClient(c, data)
 
 	return false, "", nil
 }
+
+// 处理登录/注册账号消息，返回是否成功
+func handleLoginMessage(c *model.Client, lp model.LoginPayload, limiter *loginLimiter) bool {
+	result := model.LoginResultPayload{Username: lp.Username}
+	now := time.Now()
+	ip := remoteIP(c.RemoteAddr)
+
+	// 在校验密码（bcrypt）之前限速，防止在线猜密码与耗尽 CPU
+	var err error
+	switch {
+	case !limiter.attempts.allow(now):
+		err = errors.New("too many login attempts, slow down")
+	case loginBlocked(ip, now):
+		err = errors.New("too many failed logins from this address, try again later")
+	case lp.Register:
+		err = validateUsername(lp.Username)
+		if err == nil {
+			err = auth.Register(lp.Username, lp.Password)
+		}
+	}
+	if err == nil {
+		var expires time.Time
+		result.Token, expires, err = auth.Login(lp.Username, lp.Password)
+		result.ExpiresAt = expires.UnixMilli()
+		if err != nil {
+			recordLoginFailure(ip, now)
+		}
+	}
+	if err != nil {
+		result.Notice = err.Error()
+		logging.Network.Info("登录失败", "event", "login", "player", lp.Username, "remote", c.RemoteAddr, "err", err)
+	} else {
+		result.Success = true
+		logging.Network.Info("登录成功", "event", "login", "player", lp.Username)
+	}
+
+	data, err := RePackWebMessageJson(10, result, lp.Username)
+	if err != nil {
+		logging.Network.Error("failed to marshal login result", "err", err)
+		return result.Success
+	}
+
+	sendToClient(c, data)
+	return result.Success
+}